@@ -0,0 +1,32 @@
+// Command genesis is a generic installer, which runs the tasks described
+// in a YAML or TOML definition file (genesis.yaml by default).  Like any
+// genesis installer, it can build a stand-alone installer, which carries
+// the definition and the files it needs:
+//
+//	genesis build -definition router.yaml files/
+//	./genesis.x install
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/installer"
+	_ "github.com/wx13/genesis/modules"
+)
+
+func main() {
+
+	inst := installer.New()
+
+	err := inst.LoadDefinition()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.RemoveAll(genesis.Tmpdir)
+		os.Exit(1)
+	}
+
+	inst.Done()
+
+}
@@ -20,6 +20,7 @@ func dotfiles() {
 
 	sect.AddTask(modules.LineInFile{
 		File:    "~/.bashrc",
+		Create:  true,
 		Line:    []string{"source $HOME/.mybashrc"},
 		Pattern: []string{`source \$HOME/.mybashrc`},
 	})
@@ -70,6 +71,8 @@ func sshConfig() {
 	// Enable SSH persistence.
 	sect.AddTask(modules.LineInFile{
 		File:    "~/.ssh/config",
+		Create:  true,
+		Mode:    0600,
 		Pattern: []string{`^Host \*`, "^ControlPersist"},
 		Line: []string{
 			"Host *",
@@ -83,7 +86,9 @@ func sshConfig() {
 	ips := []string{"10.0.0.*", "10.0.1.*", "192.168.1.*"}
 	for _, ip := range ips {
 		sect.AddTask(modules.LineInFile{
-			File: "~/.ssh/config",
+			File:   "~/.ssh/config",
+			Create: true,
+			Mode:   0600,
 			Pattern: []string{
 				fmt.Sprintf("^Host %s", ip),
 				"^UserKnownHostsFile",
@@ -0,0 +1,397 @@
+package genesis
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Facts stores discovered information about the target system.
+type Facts struct {
+	Arch     string
+	ArchType string
+	OS       string
+	Hostname string
+	Username string
+	Distro   string // first word of /etc/issue
+
+	// From /etc/os-release.
+	DistroID       string // e.g. "debian"
+	DistroVersion  string // e.g. "12"
+	DistroCodename string // e.g. "bookworm"
+	DistroName     string // e.g. "Debian GNU/Linux 12 (bookworm)"
+
+	Kernel   string // kernel release, e.g. "6.1.0-13-amd64"
+	Model    string // hardware model (device tree or DMI), e.g. "Raspberry Pi 4 Model B Rev 1.4"
+	CPUCount int
+	CPUModel string
+	MemTotal uint64 // bytes
+
+	Interfaces   []Interface
+	BlockDevices []BlockDevice
+	Mounts       []Mount
+
+	Virtualization string // e.g. "kvm", "docker"; empty if none was detected
+	InitSystem     string // e.g. "systemd", "openrc", "upstart", "sysvinit"
+
+	// Custom facts, from fact providers and drop-in files.
+	Custom map[string]interface{}
+}
+
+// Fact looks up a fact by name, as a string: either a field (such as
+// "DistroID" or "CPUCount") or a custom fact.
+func (facts Facts) Fact(name string) (string, bool) {
+	field := reflect.ValueOf(facts).FieldByName(name)
+	if field.IsValid() {
+		switch field.Kind() {
+		case reflect.String, reflect.Int, reflect.Uint64, reflect.Bool:
+			return fmt.Sprint(field.Interface()), true
+		}
+	}
+	value, ok := facts.Custom[name]
+	if !ok {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(value), true
+}
+
+// Interface is a network interface.
+type Interface struct {
+	Name  string
+	MAC   string
+	Addrs []string // in CIDR notation
+	Up    bool
+}
+
+// BlockDevice is a disk (or other block device).
+type BlockDevice struct {
+	Name       string // e.g. "sda", "mmcblk0"
+	Size       uint64 // bytes
+	Model      string
+	Removable  bool
+	Rotational bool
+}
+
+// Mount is a mounted filesystem.
+type Mount struct {
+	Device  string
+	Path    string
+	Type    string
+	Options []string
+}
+
+// GatherFacts learns stuff about the target system.
+func GatherFacts() Facts {
+
+	facts := Facts{Custom: make(map[string]interface{})}
+
+	// Set architecture facts.
+	facts.ArchType = runtime.GOARCH
+	facts.OS = runtime.GOOS
+	cmd := exec.Command("uname", "-m")
+	output, err := cmd.Output()
+	if err == nil {
+		facts.Arch = strings.TrimSpace(string(output))
+	}
+
+	facts.Hostname, _ = os.Hostname()
+
+	u, err := user.Current()
+	if err == nil {
+		facts.Username = u.Username
+	}
+
+	facts.CPUCount = runtime.NumCPU()
+	facts.Interfaces = gatherInterfaces()
+
+	gatherSystemFacts(&facts, "/")
+	if len(facts.Kernel) == 0 {
+		output, err := exec.Command("uname", "-r").Output()
+		if err == nil {
+			facts.Kernel = strings.TrimSpace(string(output))
+		}
+	}
+
+	return facts
+
+}
+
+// gatherSystemFacts reads facts from the files under root (usually "/").
+func gatherSystemFacts(facts *Facts, root string) {
+
+	read := func(path string) string {
+		b, err := ioutil.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(strings.Trim(string(b), "\x00"))
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(root, path))
+		return err == nil
+	}
+
+	// Learn linux distro.
+	f := strings.Fields(read("etc/issue"))
+	if len(f) > 0 {
+		facts.Distro = f[0]
+	}
+	release := parseOSRelease(read("etc/os-release"))
+	if len(release) == 0 {
+		release = parseOSRelease(read("usr/lib/os-release"))
+	}
+	facts.DistroID = release["ID"]
+	facts.DistroVersion = release["VERSION_ID"]
+	facts.DistroCodename = release["VERSION_CODENAME"]
+	facts.DistroName = release["PRETTY_NAME"]
+
+	facts.Kernel = read("proc/sys/kernel/osrelease")
+	facts.Model = read("sys/firmware/devicetree/base/model")
+	if len(facts.Model) == 0 {
+		facts.Model = read("sys/class/dmi/id/product_name")
+	}
+
+	cpuinfo := read("proc/cpuinfo")
+	facts.CPUModel = parseCPUModel(cpuinfo)
+	facts.MemTotal = parseMemTotal(read("proc/meminfo"))
+
+	facts.BlockDevices = gatherBlockDevices(root)
+	facts.Mounts = parseMounts(read("proc/self/mounts"))
+
+	facts.Virtualization = detectVirtualization(read, exists, cpuinfo)
+	facts.InitSystem = detectInitSystem(read, exists)
+
+}
+
+// parseOSRelease parses the KEY="value" lines of os-release.
+func parseOSRelease(data string) map[string]string {
+	release := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := kv[1]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"'`)
+		}
+		release[kv[0]] = value
+	}
+	return release
+}
+
+// parseCPUModel finds the CPU model in /proc/cpuinfo.  ARM systems
+// may not have a "model name", so fall back to other fields.
+func parseCPUModel(cpuinfo string) string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		if _, ok := fields[key]; !ok {
+			fields[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	for _, key := range []string{"model name", "Hardware", "Model", "cpu model", "cpu"} {
+		if len(fields[key]) > 0 {
+			return fields[key]
+		}
+	}
+	return ""
+}
+
+// parseMemTotal finds the total memory (in bytes) in /proc/meminfo.
+func parseMemTotal(meminfo string) uint64 {
+	for _, line := range strings.Split(meminfo, "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 2 && f[0] == "MemTotal:" {
+			kb, _ := strconv.ParseUint(f[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// parseMounts parses /proc/self/mounts (the fstab format).
+func parseMounts(data string) []Mount {
+	mounts := []Mount{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) < 4 {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Device:  unescapeMount(f[0]),
+			Path:    unescapeMount(f[1]),
+			Type:    f[2],
+			Options: strings.Split(f[3], ","),
+		})
+	}
+	return mounts
+}
+
+// unescapeMount undoes the octal escapes (e.g. "\040" for space)
+// in the mounts file.
+func unescapeMount(s string) string {
+	out := []byte{}
+	for k := 0; k < len(s); k++ {
+		if s[k] == '\\' && k+3 < len(s) {
+			if n, err := strconv.ParseUint(s[k+1:k+4], 8, 8); err == nil {
+				out = append(out, byte(n))
+				k += 3
+				continue
+			}
+		}
+		out = append(out, s[k])
+	}
+	return string(out)
+}
+
+// gatherBlockDevices lists the disks in /sys/block, skipping virtual
+// devices such as loop and ram disks.
+func gatherBlockDevices(root string) []BlockDevice {
+	devices := []BlockDevice{}
+	dir := filepath.Join(root, "sys/block")
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return devices
+	}
+	read := func(name, path string) string {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name, path))
+		return strings.TrimSpace(string(b))
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		sectors, _ := strconv.ParseUint(read(name, "size"), 10, 64)
+		devices = append(devices, BlockDevice{
+			Name:       name,
+			Size:       sectors * 512,
+			Model:      read(name, "device/model"),
+			Removable:  read(name, "removable") == "1",
+			Rotational: read(name, "queue/rotational") == "1",
+		})
+	}
+	return devices
+}
+
+// gatherInterfaces lists the network interfaces.
+func gatherInterfaces() []Interface {
+	interfaces := []Interface{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return interfaces
+	}
+	for _, iface := range ifaces {
+		i := Interface{
+			Name:  iface.Name,
+			MAC:   iface.HardwareAddr.String(),
+			Addrs: []string{},
+			Up:    iface.Flags&net.FlagUp != 0,
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			i.Addrs = append(i.Addrs, addr.String())
+		}
+		interfaces = append(interfaces, i)
+	}
+	return interfaces
+}
+
+// detectVirtualization looks for signs of a container or a virtual machine.
+func detectVirtualization(read func(string) string, exists func(string) bool, cpuinfo string) string {
+
+	// Containers.
+	switch {
+	case exists(".dockerenv"):
+		return "docker"
+	case exists("run/.containerenv"):
+		return "podman"
+	}
+	for _, env := range strings.Split(read("proc/1/environ"), "\x00") {
+		if strings.HasPrefix(env, "container=") {
+			return strings.TrimPrefix(env, "container=")
+		}
+	}
+	cgroup := read("proc/1/cgroup")
+	for _, name := range []string{"docker", "kubepods", "lxc"} {
+		if strings.Contains(cgroup, "/"+name) {
+			return name
+		}
+	}
+
+	// Virtual machines.
+	dmi := read("sys/class/dmi/id/sys_vendor") + " " + read("sys/class/dmi/id/product_name")
+	vms := []struct{ pattern, name string }{
+		{"KVM", "kvm"},
+		{"QEMU", "qemu"},
+		{"VMware", "vmware"},
+		{"VirtualBox", "virtualbox"},
+		{"Xen", "xen"},
+		{"Amazon EC2", "amazon"},
+		{"Google Compute Engine", "google"},
+		{"Microsoft Corporation Virtual Machine", "hyperv"},
+		{"Parallels", "parallels"},
+		{"BHYVE", "bhyve"},
+	}
+	for _, vm := range vms {
+		if strings.Contains(dmi, vm.pattern) {
+			return vm.name
+		}
+	}
+	if exists("proc/xen") {
+		return "xen"
+	}
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		if strings.HasPrefix(line, "flags") && strings.Contains(line+" ", " hypervisor ") {
+			return "vm"
+		}
+	}
+	return ""
+
+}
+
+// detectInitSystem works out which init system is running.
+func detectInitSystem(read func(string) string, exists func(string) bool) string {
+	switch {
+	case exists("run/systemd/system"):
+		return "systemd"
+	case exists("run/openrc"):
+		return "openrc"
+	}
+	comm := read("proc/1/comm")
+	switch comm {
+	case "systemd", "openrc-init", "runit", "s6-svscan":
+		return strings.TrimSuffix(comm, "-init")
+	}
+	switch {
+	case exists("sbin/initctl") && exists("etc/init"):
+		return "upstart"
+	case exists("etc/inittab"):
+		return "sysvinit"
+	}
+	return comm
+}
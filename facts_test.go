@@ -0,0 +1,185 @@
+package genesis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFakeRoot(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGatherSystemFacts(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "genesis-facts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFakeRoot(t, root, map[string]string{
+		"etc/issue": "Raspbian GNU/Linux 12 \\n \\l\n",
+		"etc/os-release": "PRETTY_NAME=\"Raspbian GNU/Linux 12 (bookworm)\"\n" +
+			"# comment\nID=raspbian\nVERSION_ID=\"12\"\nVERSION_CODENAME=bookworm\n",
+		"proc/sys/kernel/osrelease":          "6.1.21-v8+\n",
+		"sys/firmware/devicetree/base/model": "Raspberry Pi 4 Model B Rev 1.4\x00",
+		"proc/cpuinfo": "processor\t: 0\nBogoMIPS\t: 108.00\n\n" +
+			"Hardware\t: BCM2835\nModel\t\t: Raspberry Pi 4 Model B Rev 1.4\n",
+		"proc/meminfo": "MemTotal:        3884084 kB\nMemFree:          123456 kB\n",
+		"proc/self/mounts": "/dev/root / ext4 rw,noatime 0 0\n" +
+			"/dev/sda1 /media/my\\040disk vfat rw,relatime 0 0\n",
+		"sys/block/mmcblk0/size":             "62333952\n",
+		"sys/block/mmcblk0/removable":        "0\n",
+		"sys/block/mmcblk0/queue/rotational": "0\n",
+		"sys/block/sda/size":                 "1000\n",
+		"sys/block/sda/removable":            "1\n",
+		"sys/block/sda/device/model":         "Flash Disk      \n",
+		"sys/block/loop0/size":               "0\n",
+		"proc/1/comm":                        "systemd\n",
+		"run/systemd/system/.keep":           "",
+		".dockerenv":                         "",
+	})
+
+	facts := Facts{}
+	gatherSystemFacts(&facts, root)
+
+	if facts.Distro != "Raspbian" {
+		t.Error("Wrong distro:", facts.Distro)
+	}
+	if facts.DistroID != "raspbian" || facts.DistroVersion != "12" || facts.DistroCodename != "bookworm" ||
+		facts.DistroName != "Raspbian GNU/Linux 12 (bookworm)" {
+		t.Errorf("Wrong os-release facts: %+v", facts)
+	}
+	if facts.Kernel != "6.1.21-v8+" {
+		t.Error("Wrong kernel:", facts.Kernel)
+	}
+	if facts.Model != "Raspberry Pi 4 Model B Rev 1.4" {
+		t.Errorf("Wrong model: %q", facts.Model)
+	}
+	if facts.CPUModel != "BCM2835" {
+		t.Error("Wrong CPU model:", facts.CPUModel)
+	}
+	if facts.MemTotal != 3884084*1024 {
+		t.Error("Wrong memory:", facts.MemTotal)
+	}
+
+	if len(facts.BlockDevices) != 2 {
+		t.Fatalf("Wrong block devices: %+v", facts.BlockDevices)
+	}
+	sd := facts.BlockDevices[0]
+	if sd.Name != "mmcblk0" || sd.Size != 62333952*512 || sd.Removable || sd.Rotational {
+		t.Errorf("Wrong block device: %+v", sd)
+	}
+	usb := facts.BlockDevices[1]
+	if usb.Name != "sda" || !usb.Removable || usb.Model != "Flash Disk" {
+		t.Errorf("Wrong block device: %+v", usb)
+	}
+
+	if len(facts.Mounts) != 2 {
+		t.Fatalf("Wrong mounts: %+v", facts.Mounts)
+	}
+	m := facts.Mounts[1]
+	if m.Device != "/dev/sda1" || m.Path != "/media/my disk" || m.Type != "vfat" || m.Options[1] != "relatime" {
+		t.Errorf("Wrong mount: %+v", m)
+	}
+
+	if facts.Virtualization != "docker" {
+		t.Error("Wrong virtualization:", facts.Virtualization)
+	}
+	if facts.InitSystem != "systemd" {
+		t.Error("Wrong init system:", facts.InitSystem)
+	}
+
+}
+
+func TestGatherSystemFactsEmpty(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "genesis-facts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFakeRoot(t, root, map[string]string{
+		"etc/issue":                     "",
+		"usr/lib/os-release":            "ID=alpine\nVERSION_ID=3.18.4\n",
+		"proc/cpuinfo":                  "model name\t: Intel(R) Core(TM) i7\nflags\t\t: fpu vme hypervisor\n",
+		"sys/class/dmi/id/sys_vendor":   "QEMU\n",
+		"sys/class/dmi/id/product_name": "Standard PC (Q35 + ICH9, 2009)\n",
+		"run/openrc/softlevel":          "",
+	})
+
+	facts := Facts{}
+	gatherSystemFacts(&facts, root)
+
+	if facts.Distro != "" {
+		t.Error("Distro should be empty:", facts.Distro)
+	}
+	if facts.DistroID != "alpine" || facts.DistroVersion != "3.18.4" {
+		t.Errorf("Wrong os-release facts: %+v", facts)
+	}
+	if facts.CPUModel != "Intel(R) Core(TM) i7" {
+		t.Error("Wrong CPU model:", facts.CPUModel)
+	}
+	if facts.Model != "Standard PC (Q35 + ICH9, 2009)" {
+		t.Error("Wrong model:", facts.Model)
+	}
+	if facts.Virtualization != "qemu" {
+		t.Error("Wrong virtualization:", facts.Virtualization)
+	}
+	if facts.InitSystem != "openrc" {
+		t.Error("Wrong init system:", facts.InitSystem)
+	}
+	if len(facts.BlockDevices) != 0 || len(facts.Mounts) != 0 {
+		t.Errorf("Should have no disks or mounts: %+v", facts)
+	}
+
+}
+
+func TestGatherFacts(t *testing.T) {
+
+	facts := GatherFacts()
+	if len(facts.Username) == 0 {
+		t.Error("Username should be set")
+	}
+	if facts.CPUCount < 1 {
+		t.Error("Should have at least one CPU:", facts.CPUCount)
+	}
+
+}
+
+func TestFact(t *testing.T) {
+
+	facts := Facts{DistroID: "debian", CPUCount: 4, Custom: map[string]interface{}{"serial": "A123", "board": 7.0}}
+	if distro, ok := facts.Fact("DistroID"); !ok || distro != "debian" {
+		t.Error("Wrong distro:", distro, ok)
+	}
+	if cpus, ok := facts.Fact("CPUCount"); !ok || cpus != "4" {
+		t.Error("Wrong CPU count:", cpus, ok)
+	}
+	if _, ok := facts.Fact("Mounts"); ok {
+		t.Error("Mounts is not a simple fact")
+	}
+	if serial, ok := facts.Fact("serial"); !ok || serial != "A123" {
+		t.Error("Wrong serial:", serial, ok)
+	}
+	if board, ok := facts.Fact("board"); !ok || board != "7" {
+		t.Error("Wrong board:", board, ok)
+	}
+	if _, ok := facts.Fact("missing"); ok {
+		t.Error("Missing fact should not be found")
+	}
+
+}
@@ -3,59 +3,14 @@ package genesis
 import (
 	"crypto/md5"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
-	"runtime"
-	"strings"
 
 	"github.com/wx13/genesis/store"
 )
 
-// Facts stores discovered information about the target system.
-type Facts struct {
-	Arch     string
-	ArchType string
-	OS       string
-	Hostname string
-	Username string
-	Distro   string
-}
-
-// GatherFacts learns stuff about the target system.
-func GatherFacts() Facts {
-
-	facts := Facts{}
-
-	// Set architecture facts.
-	facts.ArchType = runtime.GOARCH
-	facts.OS = runtime.GOOS
-	cmd := exec.Command("uname", "-m")
-	output, err := cmd.Output()
-	if err == nil {
-		facts.Arch = strings.TrimSpace(string(output))
-	}
-
-	// Learn linux distro.
-	b, err := ioutil.ReadFile("/etc/issue")
-	if err == nil {
-		f := strings.Fields(string(b))
-		facts.Distro = f[0]
-	}
-
-	facts.Hostname, _ = os.Hostname()
-
-	u, err := user.Current()
-	if err != nil {
-		facts.Username = u.Username
-	}
-
-	return facts
-
-}
-
 var Store *store.Store
 var Tmpdir string
 
@@ -77,6 +32,13 @@ type Module interface {
 	Files() []string // list of files needed by module
 }
 
+// Targeter is implemented by modules which write to files.  Targets
+// lists the files (or directories) they change, which, unlike Files,
+// are not needed by the installer.
+type Targeter interface {
+	Targets() []string
+}
+
 // Doer can do and undo things.
 type Doer interface {
 	Do() (bool, error)
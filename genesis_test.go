@@ -24,3 +24,40 @@ func TestExpandHome(t *testing.T) {
 	}
 
 }
+
+func TestRemoteFile(t *testing.T) {
+
+	url := "https://example.com/file.sh"
+	file := genesis.RemoteFile(url, "abc123")
+	if !genesis.IsRemote(file) {
+		t.Error("File should be remote:", file)
+	}
+	u, sum := genesis.SplitRemote(file)
+	if u != url || sum != "abc123" {
+		t.Error("Could not split remote file:", u, sum)
+	}
+	u, sum = genesis.SplitRemote(genesis.RemoteFile(url, ""))
+	if u != url || sum != "" {
+		t.Error("Remote file without checksum should split cleanly:", u, sum)
+	}
+	if genesis.IsRemote("/tmp/genesis/files/file.txt") {
+		t.Error("Local file should not be remote.")
+	}
+
+}
+
+func TestVerifyChecksum(t *testing.T) {
+
+	data := []byte("hello\n")
+	sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if err := genesis.VerifyChecksum(data, sum); err != nil {
+		t.Error("Checksum should match:", err)
+	}
+	if err := genesis.VerifyChecksum(data, "0000"); err == nil {
+		t.Error("Checksum should not match.")
+	}
+	if err := genesis.VerifyChecksum(data, ""); err != nil {
+		t.Error("Empty checksum should always pass:", err)
+	}
+
+}
@@ -1,10 +1,11 @@
 package installer
 
 import (
-	"archive/zip"
 	"bytes"
+	"crypto/ed25519"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -13,102 +14,315 @@ import (
 	"github.com/wx13/genesis"
 )
 
-func getFilesToArchive(allFiles []string, tmpdir string) []string {
-	files := []string{}
+// getFilesToArchive picks out the files which live in tmpdir (where the
+// archive is extracted to), relative to tmpdir.  Files outside of tmpdir
+// are returned separately, since they are not archived.
+func getFilesToArchive(allFiles []string, tmpdir string) ([]string, []string) {
+	files, outside := []string{}, []string{}
+	seen := make(map[string]bool)
 	for _, file := range allFiles {
-		if strings.HasPrefix(file, tmpdir) {
-			p, err := filepath.Rel(tmpdir, file)
-			if err == nil {
-				files = append(files, p)
-			}
+		if seen[file] || genesis.IsRemote(file) {
+			continue
+		}
+		seen[file] = true
+		p, err := filepath.Rel(tmpdir, file)
+		if err != nil || p == ".." || strings.HasPrefix(p, "../") {
+			outside = append(outside, file)
+			continue
 		}
+		files = append(files, p)
 	}
-	return files
+	return files, outside
 }
 
-func readExec(execname string) []byte {
+// getRemotesToArchive picks out the remote resources (urls) from
+// the list of files needed by the modules.
+func getRemotesToArchive(allFiles []string) []string {
+	remotes := []string{}
+	seen := make(map[string]bool)
+	for _, file := range allFiles {
+		if genesis.IsRemote(file) && !seen[file] {
+			seen[file] = true
+			remotes = append(remotes, file)
+		}
+	}
+	return remotes
+}
+
+func readExec(execname string) ([]byte, error) {
 	execbody, err := ioutil.ReadFile(execname)
 	if err != nil {
-		fmt.Println("Error: cannot read executable (self):", execname, err)
+		return nil, fmt.Errorf("cannot read executable (self): %s: %v", execname, err)
 	}
-	return execbody
+	return execbody, nil
 }
 
-func (inst *Installer) Build() {
+// Build appends the files needed by the installer to the executable.
+// Nothing is written unless every file is found.
+func (inst *Installer) Build() error {
 
 	fmt.Println("Building the self-contained executable...")
 
-	dirs := inst.BuildDirs
-	files := getFilesToArchive(inst.Files(), genesis.Tmpdir)
-
-	execname := inst.ExecName
-	if len(execname) == 0 {
-		execname, _ = osext.Executable()
+	// Files which tasks write to are not meant to be archived.
+	names, outside := getFilesToArchive(inst.Files(), genesis.Tmpdir)
+	targets := taskTargets(inst.Tasks)
+	for _, file := range outside {
+		if len(file) == 0 || targets[genesis.ExpandHome(file)] {
+			continue
+		}
+		fmt.Println("Warning: not archiving file outside of the archive directory:", file)
+	}
+	for _, pattern := range strings.Split(inst.Include, ",") {
+		if pattern = strings.TrimSpace(pattern); len(pattern) > 0 {
+			names = append(names, pattern)
+		}
+	}
+	files, missing := expandFiles(names, inst.BuildDirs)
+	if len(missing) > 0 {
+		for _, name := range missing {
+			fmt.Printf("Could not find %s in directories %+v\n", name, inst.BuildDirs)
+		}
+		return fmt.Errorf("%d file(s) not found: %s", len(missing), strings.Join(missing, ", "))
 	}
-	execbody := readExec(execname)
 
-	// Create the zip archive.
-	buf := new(bytes.Buffer)
-	w := zip.NewWriter(buf)
-	w.SetOffset(int64(len(execbody)))
-	addFilesToArchive(w, files, dirs)
+	var key ed25519.PrivateKey
+	if len(inst.SignKey) > 0 {
+		var err error
+		key, err = readPrivateKey(genesis.ExpandHome(inst.SignKey))
+		if err != nil {
+			return fmt.Errorf("cannot read signing key: %v", err)
+		}
+	}
 
-	// Append zip to executable.
-	execbody = append(execbody, buf.Bytes()...)
+	// Read (and download) everything once, for all the executables.
+	entries, err := readFilesToArchive(files)
+	if err != nil {
+		return err
+	}
+	definition, err := inst.archivedDefinitionEntry()
+	if err != nil {
+		return fmt.Errorf("cannot read installer definition: %v", err)
+	}
+	entries = append(entries, definition...)
+	if inst.Fetch {
+		remotes, err := fetchRemotesToArchive(getRemotesToArchive(inst.Files()))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, remotes...)
+	}
 
-	// Write out executable.
-	err := ioutil.WriteFile(execname+".x", execbody, 0755)
+	execnames, err := inst.executables()
 	if err != nil {
-		fmt.Println("Error writing to zip file:", err)
-		return
+		return err
+	}
+	for k, execname := range execnames {
+		manifest, size, err := writeInstaller(execname, entries, key, inst.Bundle)
+		if err != nil {
+			return err
+		}
+		if k > 0 {
+			continue
+		}
+		manifest.print(size)
+		if key != nil {
+			fmt.Println("Signed archive manifest.")
+		}
+		if len(inst.ManifestFile) > 0 {
+			err = manifest.write(inst.ManifestFile)
+			if err != nil {
+				return fmt.Errorf("cannot write manifest: %v", err)
+			}
+		}
 	}
 
 	fmt.Println("Done building archive.")
+	return nil
 
 }
 
-func addFilesToArchive(w *zip.Writer, files, dirs []string) {
+// executables lists the executables to build installers from: those
+// given with -x, plus one compiled for each -targets platform.  By
+// default, it is the running executable.
+func (inst *Installer) executables() ([]string, error) {
 
-	fmt.Println("Adding files to archive:")
-	for _, file := range files {
-		fmt.Println("   ", file)
+	execnames := []string{}
+	for _, name := range strings.Split(inst.ExecName, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			execnames = append(execnames, name)
+		}
+	}
 
-		f, err := w.Create(file)
-		if err != nil {
-			fmt.Println("Cannot add file to archive:", file, err)
+	self, _ := osext.Executable()
+	for _, spec := range strings.Split(inst.Targets, ",") {
+		if spec = strings.TrimSpace(spec); len(spec) == 0 {
 			continue
 		}
-		body, err := readFile(file, dirs)
+		t, err := parseTarget(spec)
 		if err != nil {
-			fmt.Printf("Could not read file %s in directories %+v, because of %+v\n", file, dirs, err)
-			continue
+			return nil, err
 		}
-		_, err = f.Write(body)
+		execname := strings.TrimSuffix(filepath.Base(self), ".exe") + "-" + t.suffix()
+		fmt.Printf("Compiling %s for %s...\n", inst.Package, spec)
+		err = t.goBuild(inst.Package, execname)
 		if err != nil {
-			fmt.Println("Cannot write file contents to archive:", file, err)
-			continue
+			return nil, fmt.Errorf("cannot compile for %s: %v", spec, err)
+		}
+		execnames = append(execnames, execname)
+	}
+
+	if len(execnames) == 0 {
+		execnames = append(execnames, self)
+	}
+	return execnames, nil
+
+}
+
+// writeInstaller appends the archive to an executable, and writes it
+// out as execname.x.  With bundle, the executable is left alone, and
+// the archive is written next to it (e.g. installer.bundle).
+func writeInstaller(execname string, entries []archiveEntry, key ed25519.PrivateKey, bundle bool) (Manifest, int, error) {
+
+	execbody := []byte{}
+	if !bundle {
+		var err error
+		execbody, err = readExec(execname)
+		if err != nil {
+			return Manifest{}, 0, err
 		}
 	}
 
-	err := w.Close()
+	// Create the zip archive.
+	buf := new(bytes.Buffer)
+	p := newPayload(buf, int64(len(execbody)))
+	for _, entry := range entries {
+		err := p.add(entry.name, entry.body, entry.info)
+		if err != nil {
+			return p.manifest, 0, fmt.Errorf("cannot add file to archive: %s: %v", entry.name, err)
+		}
+	}
+	err := p.close(key)
 	if err != nil {
-		fmt.Println("Cannot close archive:", err)
+		return p.manifest, 0, fmt.Errorf("cannot close archive: %v", err)
 	}
 
+	if bundle {
+		err = ioutil.WriteFile(bundleName(execname), buf.Bytes(), 0644)
+		if err != nil {
+			return p.manifest, 0, fmt.Errorf("cannot write bundle: %v", err)
+		}
+		fmt.Println("Wrote", bundleName(execname))
+		return p.manifest, buf.Len(), nil
+	}
+
+	// Append zip to executable.
+	execbody = append(execbody, buf.Bytes()...)
+
+	// Write out executable.
+	err = ioutil.WriteFile(execname+".x", execbody, 0755)
+	if err != nil {
+		return p.manifest, 0, fmt.Errorf("cannot write executable: %v", err)
+	}
+	fmt.Println("Wrote", execname+".x")
+
+	return p.manifest, buf.Len(), nil
+
 }
 
-func readFile(file string, dirs []string) ([]byte, error) {
-	var err error
-	var body []byte
+// archiveFile is a file to be archived: its name within the archive,
+// and where to read it from.
+type archiveFile struct {
+	name string
+	path string
+}
+
+// expandFiles finds files in the build directories (the first directory
+// which has a file wins).  Names may be directories, which are included
+// recursively, or glob patterns.  Names which match nothing are returned
+// as missing.
+func expandFiles(names, dirs []string) ([]archiveFile, []string) {
+
 	if len(dirs) == 0 {
 		dirs = []string{""}
 	}
-	for _, dir := range dirs {
-		filename := filepath.Join(dir, file)
-		body, err = ioutil.ReadFile(filename)
-		if err == nil {
-			return body, nil
+	files := []archiveFile{}
+	missing := []string{}
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		found := false
+		for _, dir := range dirs {
+			matches, _ := filepath.Glob(filepath.Join(dir, name))
+			for _, match := range matches {
+				found = true
+				filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+					if err != nil || info.IsDir() {
+						return err
+					}
+					rel, err := filepath.Rel(dir, path)
+					if err != nil {
+						return err
+					}
+					rel = filepath.ToSlash(rel)
+					if !seen[rel] {
+						seen[rel] = true
+						files = append(files, archiveFile{name: rel, path: path})
+					}
+					return nil
+				})
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	return files, missing
+
+}
+
+// archiveEntry is the content of one file in the archive.
+type archiveEntry struct {
+	name string
+	body []byte
+	info os.FileInfo // mode and mtime; nil for remote files
+}
+
+// readFilesToArchive reads files, keeping their modes and
+// modification times.
+func readFilesToArchive(files []archiveFile) ([]archiveEntry, error) {
+
+	entries := []archiveEntry{}
+	for _, file := range files {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{file.name, body, info})
+	}
+	return entries, nil
+
+}
+
+// fetchRemotesToArchive downloads remote resources to add to the
+// archive, so that the installer can run offline.
+func fetchRemotesToArchive(remotes []string) ([]archiveEntry, error) {
+
+	entries := []archiveEntry{}
+	for _, remote := range remotes {
+		url, checksum := genesis.SplitRemote(remote)
+		body, err := genesis.Fetch(url, checksum)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch remote file: %s: %v", url, err)
 		}
+		entries = append(entries, archiveEntry{genesis.RemotePath(url), body, nil})
 	}
-	return body, err
+	return entries, nil
+
 }
@@ -0,0 +1,89 @@
+package installer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func TestGetFilesToArchive(t *testing.T) {
+
+	remote := genesis.RemoteFile("http://example.com/file", "")
+	allFiles := []string{
+		"/tmp/gen/a.txt",
+		"/tmp/gen/dir/b.txt",
+		"/tmp/gen/a.txt",
+		remote,
+		"/etc/hosts",
+		"/tmp/general",
+	}
+
+	files, outside := getFilesToArchive(allFiles, "/tmp/gen")
+	if !reflect.DeepEqual(files, []string{"a.txt", "dir/b.txt"}) {
+		t.Error("Wrong files to archive:", files)
+	}
+	if !reflect.DeepEqual(outside, []string{"/etc/hosts", "/tmp/general"}) {
+		t.Error("Wrong files outside of the temp dir:", outside)
+	}
+
+	remotes := getRemotesToArchive(allFiles)
+	if !reflect.DeepEqual(remotes, []string{remote}) {
+		t.Error("Wrong remote files:", remotes)
+	}
+
+}
+
+func TestExpandFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir1, dir2 := filepath.Join(dir, "one"), filepath.Join(dir, "two")
+	for _, name := range []string{"one/a.txt", "one/conf/x.conf", "one/conf/sub/y.conf", "two/a.txt", "two/b.txt", "two/script.sh"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(name), 0644)
+		os.Chmod(path, 0644) // regardless of umask
+	}
+	os.Chmod(filepath.Join(dir2, "script.sh"), 0755)
+
+	names := []string{"a.txt", "conf", "*.txt", "b.txt", "*.sh", "conf/x.conf", "missing.txt", "*.log"}
+	files, missing := expandFiles(names, []string{dir1, dir2})
+
+	// The first directory with a match wins, and each file is listed once.
+	want := []archiveFile{
+		{"a.txt", filepath.Join(dir1, "a.txt")},
+		{"conf/sub/y.conf", filepath.Join(dir1, "conf", "sub", "y.conf")},
+		{"conf/x.conf", filepath.Join(dir1, "conf", "x.conf")},
+		{"b.txt", filepath.Join(dir2, "b.txt")},
+		{"script.sh", filepath.Join(dir2, "script.sh")},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Wrong files:\n%v\nwant:\n%v", files, want)
+	}
+	if !reflect.DeepEqual(missing, []string{"missing.txt", "*.log"}) {
+		t.Error("Wrong missing files:", missing)
+	}
+
+	// Modes are kept.
+	entries, err := readFilesToArchive(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		mode := os.FileMode(0644)
+		if entry.name == "script.sh" {
+			mode = 0755
+		}
+		if entry.info.Mode().Perm() != mode || string(entry.body) == "" {
+			t.Errorf("%s was not read properly: %v", entry.name, entry.info.Mode())
+		}
+	}
+
+}
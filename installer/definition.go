@@ -0,0 +1,449 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/wx13/genesis"
+)
+
+// An installer can be described in a YAML or TOML file (a definition),
+// instead of Go code.  These are the names looked for, when -definition
+// is not given.
+var definitionNames = []string{"genesis.yaml", "genesis.yml", "genesis.toml"}
+
+// archivedDefinition is where build stores the definition in the archive
+// (plus the extension), so that the installer finds it when it runs.
+const archivedDefinition = "genesis/definition"
+
+// LoadDefinition adds the tasks described in the definition file (the
+// -definition option, or genesis.yaml, genesis.yml or genesis.toml).  An
+// installer which was built from a definition uses the archived copy.
+// The definition is required to install, remove, show the status or build.
+func (inst *Installer) LoadDefinition() error {
+
+	data, filename, err := inst.readDefinition()
+	if os.IsNotExist(err) {
+		switch inst.Cmd {
+		case "install", "remove", "status", "interactive", "build":
+			return fmt.Errorf("no installer definition found (tried %s)", strings.Join(inst.definitionCandidates(), ", "))
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	doers, err := parseDefinition(data, filepath.Ext(filename), inst)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	inst.Tasks = append(inst.Tasks, doers...)
+	if inst.Cmd == "build" {
+		inst.definitionFile = filename
+	}
+	return nil
+
+}
+
+func (inst *Installer) definitionCandidates() []string {
+	if len(inst.Definition) > 0 {
+		return []string{inst.Definition}
+	}
+	return definitionNames
+}
+
+// readDefinition finds and reads the definition file.  When it is not
+// found, the error satisfies os.IsNotExist.
+func (inst *Installer) readDefinition() ([]byte, string, error) {
+
+	if len(inst.Definition) == 0 && inst.Cmd != "build" {
+		for _, ext := range []string{".yaml", ".toml"} {
+			name := archivedDefinition + ext
+			data, err := inst.readArchived(name)
+			if err == nil {
+				return data, name, nil
+			}
+			if !os.IsNotExist(err) {
+				return nil, name, err
+			}
+		}
+	}
+
+	for _, name := range inst.definitionCandidates() {
+		name = genesis.ExpandHome(name)
+		data, err := ioutil.ReadFile(name)
+		if err == nil || !os.IsNotExist(err) {
+			return data, name, err
+		}
+	}
+	return nil, "", &os.PathError{Op: "open", Path: "definition", Err: os.ErrNotExist}
+
+}
+
+// readArchived reads a file from the installer's archive: from the
+// payload if it is not yet extracted (-lazy), or from genesis.Tmpdir.
+func (inst *Installer) readArchived(name string) ([]byte, error) {
+	if inst.payload != nil {
+		return inst.readPayloadFile(name)
+	}
+	if len(genesis.Tmpdir) == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.ReadFile(filepath.Join(genesis.Tmpdir, filepath.FromSlash(name)))
+}
+
+// archivedDefinitionEntry is the definition file, to add to the archive.
+func (inst *Installer) archivedDefinitionEntry() ([]archiveEntry, error) {
+	if len(inst.definitionFile) == 0 {
+		return []archiveEntry{}, nil
+	}
+	info, err := os.Stat(inst.definitionFile)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadFile(inst.definitionFile)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(inst.definitionFile)
+	if ext == ".yml" {
+		ext = ".yaml"
+	}
+	return []archiveEntry{{archivedDefinition + ext, body, info}}, nil
+}
+
+// parseDefinition reads the tasks from a definition:
+//
+//	tasks:
+//	  - mkdir: {path: /tmp/foo}
+//	  - section: Configure the network
+//	    tasks: [...]
+//	  - if: {lineinfile: {...}}
+//	    then: {command: {cmd: /etc/init.d/networking, opts: [restart]}}
+//	  - switch: Network manager
+//	    cases:
+//	      - when: {fact: DistroID, equals: debian}
+//	        tasks: [...]
+//	    else: [...]
+//	  - when: {file_exists: /usr/bin/tig}
+//	    tasks: [...]
+//
+// Conditions are {fact: NAME, equals: VALUE}, {file_exists: PATH} or
+// {command_succeeds: COMMAND}.  Switch conditions are checked when the
+// definition is loaded; "when" and "unless" conditions when they run.
+func parseDefinition(data []byte, ext string, inst *Installer) ([]genesis.Doer, error) {
+
+	var def map[string]interface{}
+	switch ext {
+	case ".yaml", ".yml":
+		err := yaml.Unmarshal(data, &def)
+		if err != nil {
+			return nil, err
+		}
+	case ".toml":
+		_, err := toml.Decode(string(data), &def)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown definition format %q; use .yaml or .toml", ext)
+	}
+
+	p := defParser{inst}
+	fields, err := p.fields(def, "definition", "tasks")
+	if err != nil {
+		return nil, err
+	}
+	if fields["tasks"] == nil {
+		return nil, errors.New("definition has no tasks")
+	}
+	return p.doers(fields["tasks"], "tasks")
+
+}
+
+type defParser struct {
+	inst *Installer
+}
+
+// fields checks that a map has only the allowed keys (which are matched
+// without regard to case, underscores or dashes).
+func (p defParser) fields(data interface{}, path string, allowed ...string) (map[string]interface{}, error) {
+	m, ok := genesis.ToMap(data)
+	if !ok {
+		return nil, fmt.Errorf("%s: want a map, not %v", path, data)
+	}
+	fields := make(map[string]interface{})
+	for key, value := range m {
+		k := genesis.NormalizeName(key)
+		found := false
+		for _, a := range allowed {
+			if k == genesis.NormalizeName(a) {
+				fields[a] = value
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+	}
+	return fields, nil
+}
+
+func (p defParser) doers(data interface{}, path string) ([]genesis.Doer, error) {
+	list := reflect.ValueOf(data)
+	if data == nil || list.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%s: want a list, not %v", path, data)
+	}
+	doers := []genesis.Doer{}
+	for k := 0; k < list.Len(); k++ {
+		doer, err := p.doer(list.Index(k).Interface(), fmt.Sprintf("%s[%d]", path, k))
+		if err != nil {
+			return nil, err
+		}
+		doers = append(doers, doer)
+	}
+	return doers, nil
+}
+
+func (p defParser) group(data interface{}, path string) (genesis.Doer, error) {
+	doers, err := p.doers(data, path)
+	if err != nil {
+		return nil, err
+	}
+	return Section{Tasks: doers}, nil
+}
+
+func (p defParser) doer(data interface{}, path string) (genesis.Doer, error) {
+
+	m, ok := genesis.ToMap(data)
+	if !ok || len(m) == 0 {
+		return nil, fmt.Errorf("%s: want a task, not %v", path, data)
+	}
+	has := func(key string) bool {
+		for k := range m {
+			if genesis.NormalizeName(k) == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+
+	case has("section"):
+		fields, err := p.fields(m, path, "section", "tasks", "tags")
+		if err != nil {
+			return nil, err
+		}
+		name, ok := fields["section"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: section name should be a string", path)
+		}
+		doers, err := p.doers(fields["tasks"], path+".tasks")
+		if err != nil {
+			return nil, err
+		}
+		tags, err := p.tags(fields["tags"], path+".tags")
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) > 0 {
+			return Tag(Section{Name: name, Tasks: doers}, tags...), nil
+		}
+		return Section{Name: name, Tasks: doers}, nil
+
+	case has("if"):
+		fields, err := p.fields(m, path, "if", "then")
+		if err != nil {
+			return nil, err
+		}
+		ifDoer, err := p.doer(fields["if"], path+".if")
+		if err != nil {
+			return nil, err
+		}
+		thenDoer, err := p.doer(fields["then"], path+".then")
+		if err != nil {
+			return nil, err
+		}
+		return IfThen{If: ifDoer, Then: thenDoer}, nil
+
+	case has("switch"):
+		fields, err := p.fields(m, path, "switch", "cases", "else")
+		if err != nil {
+			return nil, err
+		}
+		name, _ := fields["switch"].(string)
+		sw := NewSwitch(name)
+		cases := reflect.ValueOf(fields["cases"])
+		if fields["cases"] == nil || cases.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("%s: switch needs a list of cases", path)
+		}
+		for k := 0; k < cases.Len(); k++ {
+			casePath := fmt.Sprintf("%s.cases[%d]", path, k)
+			c, err := p.fields(cases.Index(k).Interface(), casePath, "when", "tasks")
+			if err != nil {
+				return nil, err
+			}
+			cond, err := p.condition(c["when"], casePath+".when")
+			if err != nil {
+				return nil, err
+			}
+			group, err := p.group(c["tasks"], casePath+".tasks")
+			if err != nil {
+				return nil, err
+			}
+			sw.Case(cond(), group)
+		}
+		if fields["else"] != nil {
+			group, err := p.group(fields["else"], path+".else")
+			if err != nil {
+				return nil, err
+			}
+			sw.Else(group)
+		}
+		return sw, nil
+
+	case has("when"), has("unless"):
+		key := "when"
+		if has("unless") {
+			key = "unless"
+		}
+		fields, err := p.fields(m, path, key, "tasks")
+		if err != nil {
+			return nil, err
+		}
+		cond, err := p.condition(fields[key], path+"."+key)
+		if err != nil {
+			return nil, err
+		}
+		group, err := p.group(fields["tasks"], path+".tasks")
+		if err != nil {
+			return nil, err
+		}
+		if key == "unless" {
+			return Unless(cond, group), nil
+		}
+		return When(cond, group), nil
+
+	}
+
+	// Otherwise, it is a module (perhaps with tags).
+	tags := []string{}
+	for key, value := range m {
+		if genesis.NormalizeName(key) != "tags" {
+			continue
+		}
+		var err error
+		tags, err = p.tags(value, path+"."+key)
+		if err != nil {
+			return nil, err
+		}
+		m = copyWithout(m, key)
+	}
+	if len(m) != 1 {
+		return nil, fmt.Errorf("%s: a task should have one module, not %d keys", path, len(m))
+	}
+	for name, value := range m {
+		fields := map[string]interface{}{}
+		if value != nil {
+			fields, ok = genesis.ToMap(value)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s: want a map of fields, not %v", path, name, value)
+			}
+		}
+		module, err := genesis.NewModule(name, fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(tags) > 0 {
+			return Tag(Task{module}, tags...), nil
+		}
+		return Task{module}, nil
+	}
+	return nil, nil
+
+}
+
+// tags reads a tag, or a list of tags.
+func (p defParser) tags(data interface{}, path string) ([]string, error) {
+	tags := []string{}
+	switch t := data.(type) {
+	case nil:
+	case string:
+		tags = append(tags, t)
+	case []interface{}:
+		for _, tag := range t {
+			s, ok := tag.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: want a tag name, not %v", path, tag)
+			}
+			tags = append(tags, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: want a tag or a list of tags, not %v", path, data)
+	}
+	for _, tag := range tags {
+		if len(tag) == 0 || strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("%s: tag %q should be non-empty, without commas", path, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (p defParser) condition(data interface{}, path string) (Condition, error) {
+
+	fields, err := p.fields(data, path, "fact", "equals", "file_exists", "command_succeeds")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case fields["fact"] != nil:
+		name, ok := fields["fact"].(string)
+		if !ok || fields["equals"] == nil || len(fields) != 2 {
+			return nil, fmt.Errorf("%s: want {fact: NAME, equals: VALUE}", path)
+		}
+		return p.inst.FactEquals(name, fmt.Sprint(fields["equals"])), nil
+	case fields["file_exists"] != nil && len(fields) == 1:
+		name, ok := fields["file_exists"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: file_exists needs a path", path)
+		}
+		return FileExists(name), nil
+	case fields["command_succeeds"] != nil && len(fields) == 1:
+		args := []string{}
+		switch cmd := fields["command_succeeds"].(type) {
+		case string:
+			args = strings.Fields(cmd)
+		case []interface{}:
+			for _, arg := range cmd {
+				args = append(args, fmt.Sprint(arg))
+			}
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: command_succeeds needs a command", path)
+		}
+		return CommandSucceeds(args[0], args[1:]...), nil
+	}
+	return nil, fmt.Errorf("%s: want one of fact/equals, file_exists or command_succeeds", path)
+
+}
+
+func copyWithout(m map[string]interface{}, key string) map[string]interface{} {
+	c := make(map[string]interface{})
+	for k, v := range m {
+		if k != key {
+			c[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,67 @@
+package installer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func init() {
+	genesis.RegisterModule("TestModule", testModule{}, genesis.ModuleDoc{
+		Description: "A module for testing.",
+	})
+}
+
+func TestParseDefinition(t *testing.T) {
+
+	inst := &Installer{}
+	doers, err := parseDefinition([]byte(`
+tasks:
+  - test_module: {name: a}
+    tags: [x, y]
+  - section: S
+    tasks:
+      - if: {test_module: {name: b}}
+        then: {test_module: {name: c}}
+  - unless: {file_exists: /no/such/file}
+    tasks: [{test_module: {name: d}}]
+`), ".yaml", inst)
+	if err != nil || len(doers) != 3 {
+		t.Fatal("Could not parse definition:", err, doers)
+	}
+	if len(TaskTags(doers)) != 4 {
+		t.Error("Definition should have 4 tasks, not", len(TaskTags(doers)))
+	}
+
+	tests := []struct {
+		ext  string
+		data string
+		err  string
+	}{
+		{".json", `{}`, `unknown definition format ".json"`},
+		{".yaml", `tasks: [`, `yaml:`},
+		{".toml", `tasks = 3`, `tasks: want a list`},
+		{".yaml", `{}`, `definition has no tasks`},
+		{".yaml", "tasks: []\nextra: 1", `definition: unknown key "extra"`},
+		{".yaml", `tasks: [3]`, `tasks[0]: want a task`},
+		{".yaml", `tasks: [{nosuch: {}}]`, `tasks[0]:`},
+		{".yaml", `tasks: [{test_module: {name: a}, other: {}}]`, `tasks[0]: a task should have one module, not 2 keys`},
+		{".yaml", `tasks: [{test_module: 3}]`, `tasks[0]: test_module: want a map of fields`},
+		{".yaml", `tasks: [{test_module: {}, tags: "a,b"}]`, `tasks[0].tags: tag "a,b" should be non-empty, without commas`},
+		{".yaml", `tasks: [{section: 3, tasks: []}]`, `tasks[0]: section name should be a string`},
+		{".yaml", `tasks: [{section: s, tasks: [{if: {test_module: {}}, then: 3}]}]`, `tasks[0].tasks[0].then: want a task`},
+		{".yaml", `tasks: [{switch: s}]`, `tasks[0]: switch needs a list of cases`},
+		{".yaml", `tasks: [{switch: s, cases: [{when: {file_exists: /}}]}]`, `tasks[0].cases[0].tasks: want a list`},
+		{".yaml", `tasks: [{when: {fact: x}, tasks: []}]`, `tasks[0].when: want {fact: NAME, equals: VALUE}`},
+		{".yaml", `tasks: [{when: {command_succeeds: []}, tasks: []}]`, `tasks[0].when: command_succeeds needs a command`},
+		{".yaml", `tasks: [{when: {nosuch: x}, tasks: []}]`, `tasks[0].when: unknown key "nosuch"`},
+	}
+	for _, test := range tests {
+		_, err := parseDefinition([]byte(test.data), test.ext, inst)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error should contain %q, not %v", test.data, test.err, err)
+		}
+	}
+
+}
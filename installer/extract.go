@@ -0,0 +1,406 @@
+package installer
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kardianos/osext"
+
+	"github.com/wx13/genesis"
+)
+
+// Limits on what the installer will extract from its archive, to guard
+// against damaged or malicious archives.  Change them before calling
+// installer.New, if needed.
+var (
+	MaxFileSize    int64 = 1 << 30 // any one file
+	MaxArchiveSize int64 = 4 << 30 // all files
+)
+
+// payloadFile is a file in the payload, which is either a zip archive
+// (appended to the executable, or a separate bundle) or a directory.
+type payloadFile struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+	open  func() (io.ReadCloser, error)
+}
+
+// payloadPath finds the payload: the -payload option, a bundle next to
+// the executable (e.g. installer.bundle), or the executable itself.
+func (inst *Installer) payloadPath() string {
+	if len(inst.Payload) > 0 {
+		return genesis.ExpandHome(inst.Payload)
+	}
+	self, _ := osext.Executable()
+	bundle := bundleName(self)
+	if _, err := os.Stat(bundle); err == nil {
+		return bundle
+	}
+	return self
+}
+
+// bundleName is the name of the bundle for an executable.
+func bundleName(execname string) string {
+	return strings.TrimSuffix(execname, ".exe") + ".bundle"
+}
+
+// openArchive opens the payload, and checks it before anything is
+// extracted: the manifest (and its signature), the names of all the
+// files, and their sizes.
+func (inst *Installer) openArchive() error {
+
+	filename := inst.payloadPath()
+
+	var key ed25519.PublicKey
+	if len(inst.VerifyKey) > 0 {
+		var err error
+		key, err = readPublicKey(genesis.ExpandHome(inst.VerifyKey))
+		if err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(filename)
+	if err == nil && info.IsDir() {
+		return inst.openPayloadDir(filename, key)
+	}
+
+	zipRdr, err := zip.OpenReader(filename)
+	if err != nil {
+		if key != nil || len(inst.Payload) > 0 {
+			return fmt.Errorf("no archive in %s: %v", filename, err)
+		}
+		fmt.Println("Couldn't extract files.", err, filename)
+		return nil
+	}
+
+	read := func(name string) ([]byte, error) {
+		return readZipFile(&zipRdr.Reader, name)
+	}
+	manifest, err := readManifest(read, key)
+	if err != nil {
+		zipRdr.Close()
+		return err
+	}
+
+	files := []payloadFile{}
+	for _, file := range zipRdr.File {
+		if file.Name == manifestName || file.Name == signatureName || file.FileInfo().IsDir() {
+			continue
+		}
+		files = append(files, payloadFile{
+			name:  file.Name,
+			size:  int64(file.UncompressedSize64),
+			mode:  file.FileInfo().Mode(),
+			mtime: file.FileInfo().ModTime(),
+			open:  file.Open,
+		})
+	}
+	err = checkPayload(files, &manifest)
+	if err != nil {
+		zipRdr.Close()
+		return err
+	}
+
+	inst.payload = files
+	inst.manifest = &manifest
+	inst.closer = zipRdr
+	return nil
+
+}
+
+// openPayloadDir uses a directory as the payload.  If the directory has a
+// manifest (e.g. it is an unzipped bundle), it is checked like an archive.
+// Otherwise, every file in it is part of the payload.
+func (inst *Installer) openPayloadDir(dir string, key ed25519.PublicKey) error {
+
+	read := func(name string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	var manifest *Manifest
+	if _, err := read(manifestName); err == nil || key != nil {
+		m, err := readManifest(read, key)
+		if err != nil {
+			return err
+		}
+		manifest = &m
+	}
+
+	files := []payloadFile{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(path)
+		}
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == manifestName || name == signatureName {
+			return nil
+		}
+		if manifest != nil {
+			if _, ok := manifest.find(name); !ok {
+				return nil // not part of the payload
+			}
+		}
+		files = append(files, payloadFile{
+			name:  name,
+			size:  info.Size(),
+			mode:  info.Mode(),
+			mtime: info.ModTime(),
+			open:  func() (io.ReadCloser, error) { return os.Open(path) },
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = checkPayload(files, manifest)
+	if err != nil {
+		return err
+	}
+
+	inst.payload = files
+	inst.manifest = manifest
+	return nil
+
+}
+
+// checkPayload makes sure that the payload matches its manifest (if
+// there is one), that every file would be extracted within the temp
+// directory, and that the size limits are respected.
+func checkPayload(files []payloadFile, manifest *Manifest) error {
+
+	inPayload := make(map[string]bool)
+	total := int64(0)
+	for _, file := range files {
+		_, err := extractPath(file.name)
+		if err != nil {
+			return err
+		}
+		if inPayload[file.name] {
+			return fmt.Errorf("%s is in the archive twice", file.name)
+		}
+		inPayload[file.name] = true
+		if manifest != nil {
+			entry, ok := manifest.find(file.name)
+			if !ok {
+				return fmt.Errorf("%s is not in the archive manifest", file.name)
+			}
+			if entry.Size != file.size {
+				return fmt.Errorf("%s does not match its size in the manifest", file.name)
+			}
+		}
+		if file.size > MaxFileSize {
+			return fmt.Errorf("%s is too big (%d bytes; limit is %d)", file.name, file.size, MaxFileSize)
+		}
+		total += file.size
+		if total > MaxArchiveSize {
+			return fmt.Errorf("archive is too big (limit is %d bytes)", MaxArchiveSize)
+		}
+	}
+
+	if manifest != nil {
+		for _, entry := range manifest.Files {
+			if !inPayload[entry.Name] {
+				return fmt.Errorf("%s is missing from the archive", entry.Name)
+			}
+		}
+	}
+	return nil
+
+}
+
+// extractPath is where a file in the archive is extracted to.  Names
+// which would end up outside of the temp directory are rejected.
+func extractPath(name string) (string, error) {
+	clean := path.Clean(name)
+	if len(name) == 0 || strings.Contains(name, `\`) || path.IsAbs(clean) ||
+		clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("archive contains a bad file name: %q", name)
+	}
+	dest := filepath.Join(genesis.Tmpdir, filepath.FromSlash(clean))
+	rel, err := filepath.Rel(genesis.Tmpdir, dest)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive contains a bad file name: %q", name)
+	}
+	return dest, nil
+}
+
+// extractFiles unpacks files from the payload into genesis.Tmpdir,
+// checking every file against the manifest.  If names is nil, all the
+// files are extracted; otherwise only files matching one of the names
+// (a file, a directory or a glob pattern, relative to genesis.Tmpdir).
+func (inst *Installer) extractFiles(names []string) error {
+
+	if inst.payload == nil {
+		return nil
+	}
+	defer func() {
+		if inst.closer != nil {
+			inst.closer.Close()
+		}
+		inst.payload = nil
+		inst.closer = nil
+	}()
+
+	for _, file := range inst.payload {
+		if names != nil && !matchName(file.name, names) {
+			continue
+		}
+		dest, err := extractPath(file.name)
+		if err != nil {
+			return err
+		}
+		var entry *ManifestFile
+		if inst.manifest != nil {
+			e, _ := inst.manifest.find(file.name)
+			entry = &e
+		}
+		err = extractFile(file, dest, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readPayloadFile reads one file from the payload, before it is extracted,
+// checking it against the manifest (if there is one).
+func (inst *Installer) readPayloadFile(name string) ([]byte, error) {
+	for _, file := range inst.payload {
+		if file.name != name {
+			continue
+		}
+		rc, err := file.open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(rc, file.size+1))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", name, err)
+		}
+		if int64(len(data)) != file.size {
+			return nil, fmt.Errorf("%s is not the expected size", name)
+		}
+		if inst.manifest != nil {
+			entry, _ := inst.manifest.find(name)
+			if fmt.Sprintf("%x", sha256.Sum256(data)) != entry.Sha256 {
+				return nil, fmt.Errorf("%s does not match its checksum; the installer has been modified", name)
+			}
+		}
+		return data, nil
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// matchName checks if a file in the archive is one of the names.
+func matchName(name string, names []string) bool {
+	for _, n := range names {
+		n = filepath.ToSlash(n)
+		if name == n || strings.HasPrefix(name, strings.TrimSuffix(n, "/")+"/") {
+			return true
+		}
+		if ok, _ := path.Match(n, name); ok {
+			return true
+		}
+		// A file within a directory matched by a glob.
+		for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if ok, _ := path.Match(n, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// extractFile extracts one file, and checks its size and checksum (if
+// there is a manifest).  The zip reader also checks the CRC as the file
+// is read.
+func extractFile(file payloadFile, dest string, entry *ManifestFile) error {
+
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	perms := file.mode.Perm()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perms)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	err = out.Chmod(perms) // not subject to umask
+	if err != nil {
+		return err
+	}
+	rc, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(rc, file.size+1))
+	if err != nil {
+		return fmt.Errorf("cannot extract %s: %v", file.name, err)
+	}
+	if n != file.size {
+		return fmt.Errorf("%s is not the expected size", file.name)
+	}
+	if entry != nil && fmt.Sprintf("%x", hash.Sum(nil)) != entry.Sha256 {
+		return fmt.Errorf("%s does not match its checksum; the installer has been modified", file.name)
+	}
+	err = out.Close()
+	if err != nil {
+		return fmt.Errorf("cannot extract %s: %v", file.name, err)
+	}
+
+	return os.Chtimes(dest, file.mtime, file.mtime)
+
+}
+
+// lazyNames lists the archived files which are needed by the given
+// files: local files within tmpdir, and remote files fetched at build
+// time (stored under genesis.RemotePath).
+func lazyNames(files []string, tmpdir string) []string {
+	names, _ := getFilesToArchive(files, tmpdir)
+	for _, remote := range getRemotesToArchive(files) {
+		url, _ := genesis.SplitRemote(remote)
+		names = append(names, genesis.RemotePath(url))
+	}
+	return names
+}
+
+// selectedFiles lists the files needed by the doers which will run,
+// given DoTags and SkipTags.  It follows the same rules as the doers
+// themselves; when in doubt, all of a doer's files are included.
+func selectedFiles(doers []genesis.Doer) []string {
+	files := []string{}
+	eachDoer(doers, false, func(doer genesis.Doer, children []genesis.Doer, skip string) {
+		_, isTask := doer.(Task)
+		switch {
+		case children != nil && skip != "skip":
+			files = append(files, selectedFiles(children)...)
+		case children == nil && (skip == "do" || !isTask):
+			files = append(files, doer.Files()...)
+		}
+	})
+	return files
+}
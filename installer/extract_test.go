@@ -0,0 +1,259 @@
+package installer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+// tempTmpdir points genesis.Tmpdir at a new directory, and returns a
+// function which cleans up.
+func tempTmpdir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "genesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpdir := genesis.Tmpdir
+	genesis.Tmpdir = filepath.Join(dir, "tmp")
+	return func() {
+		genesis.Tmpdir = tmpdir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLazyRemote(t *testing.T) {
+
+	defer tempTmpdir(t)()
+	setTags(nil, nil)
+
+	body := []byte("remote file\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+	url := server.URL + "/file.txt"
+	remote := genesis.RemoteFile(url, fmt.Sprintf("%x", sha256.Sum256(body)))
+
+	// Build with -fetch, as a bundle.
+	execname := filepath.Join(filepath.Dir(genesis.Tmpdir), "installer")
+	entries, err := fetchRemotesToArchive(getRemotesToArchive([]string{remote}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = writeInstaller(execname, entries, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Install with -lazy.
+	inst := Installer{Payload: bundleName(execname)}
+	err = inst.openArchive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.closer.Close()
+	inst.Tasks = []genesis.Doer{Task{testModule{Name: "remote", File: remote}}}
+	err = inst.extractFiles(lazyNames(selectedFiles(inst.Tasks), genesis.Tmpdir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(genesis.Tmpdir, genesis.RemotePath(url)))
+	if err != nil {
+		t.Fatalf("remote file was not extracted: %v", err)
+	}
+	if string(got) != string(body) {
+		t.Errorf("extracted %q, want %q", got, body)
+	}
+
+}
+
+func TestExtractPath(t *testing.T) {
+
+	defer tempTmpdir(t)()
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"file.txt", true},
+		{"dir/file.txt", true},
+		{"dir/../file.txt", true},
+		{"", false},
+		{"..", false},
+		{"../x", false},
+		{"dir/../../x", false},
+		{"/etc/passwd", false},
+		{`a\..\b`, false},
+		{`..\x`, false},
+	}
+
+	for _, test := range tests {
+		dest, err := extractPath(test.name)
+		if test.ok && err != nil {
+			t.Errorf("%q should be allowed: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%q should be rejected, not extracted to %s", test.name, dest)
+		}
+	}
+
+}
+
+// testPayloadFile is a file in a payload, with the given content.
+func testPayloadFile(name, content string) payloadFile {
+	return payloadFile{
+		name: name,
+		size: int64(len(content)),
+		mode: 0644,
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func TestCheckPayload(t *testing.T) {
+
+	maxFileSize, maxArchiveSize := MaxFileSize, MaxArchiveSize
+	defer func() { MaxFileSize, MaxArchiveSize = maxFileSize, maxArchiveSize }()
+	MaxFileSize, MaxArchiveSize = 10, 15
+
+	a := testPayloadFile("a", "hello")
+	b := testPayloadFile("dir/b", "world!")
+	manifest := &Manifest{Files: []ManifestFile{{Name: "a", Size: 5}, {Name: "dir/b", Size: 6}}}
+
+	tests := []struct {
+		desc     string
+		files    []payloadFile
+		manifest *Manifest
+		ok       bool
+	}{
+		{"no manifest", []payloadFile{a, b}, nil, true},
+		{"manifest", []payloadFile{a, b}, manifest, true},
+		{"parent dir", []payloadFile{testPayloadFile("../x", "")}, nil, false},
+		{"absolute path", []payloadFile{testPayloadFile("/etc/passwd", "")}, nil, false},
+		{"backslashes", []payloadFile{testPayloadFile(`a\..\b`, "")}, nil, false},
+		{"duplicate", []payloadFile{a, b, a}, nil, false},
+		{"oversize file", []payloadFile{testPayloadFile("big", "01234567890")}, nil, false},
+		{"oversize archive", []payloadFile{a, b, testPayloadFile("c", "12345")}, nil, false},
+		{"not in manifest", []payloadFile{a, b, testPayloadFile("c", "")}, manifest, false},
+		{"wrong size", []payloadFile{a, testPayloadFile("dir/b", "world")}, manifest, false},
+		{"missing file", []payloadFile{a}, manifest, false},
+	}
+
+	for _, test := range tests {
+		err := checkPayload(test.files, test.manifest)
+		if test.ok && err != nil {
+			t.Errorf("%s: payload should be accepted: %v", test.desc, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: payload should be rejected", test.desc)
+		}
+	}
+
+}
+
+func TestMatchName(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		names []string
+		match bool
+	}{
+		{"a.txt", []string{"a.txt"}, true},
+		{"a.txt", []string{"b.txt"}, false},
+		{"dir/a.txt", []string{"dir"}, true},
+		{"dir/a.txt", []string{"dir/"}, true},
+		{"dirt/a.txt", []string{"dir"}, false},
+		{"dir/a.txt", []string{"*.txt"}, false},
+		{"dir/a.txt", []string{"dir/*.txt"}, true},
+		{"dir/sub/a.txt", []string{"d*"}, true},
+		{"a.txt", []string{}, false},
+		{"remote/abc", []string{"x", "remote/abc"}, true},
+	}
+
+	for _, test := range tests {
+		if matchName(test.name, test.names) != test.match {
+			t.Errorf("matchName(%q, %q) should be %v", test.name, test.names, test.match)
+		}
+	}
+
+}
+
+func TestOpenPayloadDir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, body := range map[string]string{"a": "hello", "sub/b": "world", "c": "extra"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(body), 0644)
+	}
+	payloadNames := func(inst Installer) []string {
+		names := []string{}
+		for _, file := range inst.payload {
+			names = append(names, file.name)
+		}
+		return names
+	}
+
+	// Without a manifest, every file is in the payload.
+	inst := Installer{}
+	err = inst.openPayloadDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.manifest != nil || strings.Join(payloadNames(inst), ",") != "a,c,sub/b" {
+		t.Error("Wrong payload without a manifest:", payloadNames(inst))
+	}
+
+	// With a manifest, only the files in it.
+	manifest := Manifest{Files: []ManifestFile{
+		{Name: "a", Size: 5, Sha256: fmt.Sprintf("%x", sha256.Sum256([]byte("hello")))},
+		{Name: "sub/b", Size: 5, Sha256: fmt.Sprintf("%x", sha256.Sum256([]byte("world")))},
+	}}
+	os.MkdirAll(filepath.Join(dir, "genesis"), 0755)
+	err = manifest.write(filepath.Join(dir, filepath.FromSlash(manifestName)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst = Installer{}
+	err = inst.openPayloadDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.manifest == nil || strings.Join(payloadNames(inst), ",") != "a,sub/b" {
+		t.Error("Wrong payload with a manifest:", payloadNames(inst))
+	}
+
+	// A file which does not match the manifest.
+	ioutil.WriteFile(filepath.Join(dir, "a"), []byte("hello, world"), 0644)
+	inst = Installer{}
+	err = inst.openPayloadDir(dir, nil)
+	if err == nil {
+		t.Error("Payload should not match its manifest")
+	}
+
+	// A key requires a signed manifest.
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	inst = Installer{}
+	err = inst.openPayloadDir(dir, pub)
+	if err == nil {
+		t.Error("Unsigned payload should be rejected")
+	}
+
+}
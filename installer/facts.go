@@ -0,0 +1,155 @@
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wx13/genesis"
+)
+
+// DefaultFactsDir holds drop-in fact files (see -facts-dir).
+const DefaultFactsDir = "/etc/genesis/facts.d"
+
+// FactTimeout limits how long an executable drop-in fact file may run.
+var FactTimeout = 10 * time.Second
+
+// FactFunc computes a custom fact, such as a serial number read from an
+// EEPROM.  The built-in facts are gathered by the time it is called.
+type FactFunc func(facts genesis.Facts) (interface{}, error)
+
+// gatherFacts learns about the target system: the built-in facts, and
+// the custom facts from the drop-in files in inst.FactsDir.
+func (inst *Installer) gatherFacts() {
+
+	inst.Facts = genesis.GatherFacts()
+	custom, errs := readFactsDir(inst.FactsDir)
+	for _, err := range errs {
+		fmt.Println("Warning: cannot read facts:", err)
+	}
+	for name, value := range custom {
+		inst.Facts.Custom[name] = value
+	}
+
+}
+
+// AddFact registers a custom fact, which is stored (by name) in
+// inst.Facts.Custom.  It overrides a drop-in fact of the same name.
+// Register facts before using them, e.g. in Switch conditions.
+func (inst *Installer) AddFact(name string, fn FactFunc) {
+
+	if inst.Facts.Custom == nil {
+		return // facts are not needed for this command
+	}
+	value, err := fn(inst.Facts)
+	if err != nil {
+		fmt.Printf("Warning: cannot gather fact %s: %v\n", name, err)
+		return
+	}
+	inst.Facts.Custom[name] = value
+
+}
+
+// readFactsDir reads the drop-in fact files in a directory (in order of
+// name).  Executable files are run (for up to FactTimeout), and other
+// files are read.  Either way, the content is a JSON object, or lines of
+// key=value.  A file which cannot be read is reported, and the rest are
+// still read.  A missing directory has no facts.
+func readFactsDir(dir string) (map[string]interface{}, []error) {
+
+	facts := make(map[string]interface{})
+	if len(dir) == 0 {
+		return facts, nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return facts, nil
+	}
+	if err != nil {
+		return facts, []error{err}
+	}
+
+	errs := []error{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		values, err := readFactsFile(path, entry.Mode()&0111 != 0)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", path, err))
+			continue
+		}
+		for name, value := range values {
+			facts[name] = value
+		}
+	}
+	return facts, errs
+
+}
+
+// readFactsFile reads (or runs) one drop-in fact file.
+func readFactsFile(path string, executable bool) (map[string]interface{}, error) {
+	if !executable {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return parseFacts(data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), FactTimeout)
+	defer cancel()
+	data, err := exec.CommandContext(ctx, path).Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %v", FactTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseFacts(data)
+}
+
+// parseFacts parses a JSON object, or key=value lines (blank lines and
+// comments starting with "#" are skipped).
+func parseFacts(data []byte) (map[string]interface{}, error) {
+
+	facts := make(map[string]interface{})
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		err := json.Unmarshal(trimmed, &facts)
+		return facts, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return facts, fmt.Errorf("bad fact line: %q", line)
+		}
+		facts[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return facts, scanner.Err()
+
+}
+
+// PrintFacts prints all the facts as JSON.
+func (inst *Installer) PrintFacts() error {
+	data, err := json.MarshalIndent(inst.Facts, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
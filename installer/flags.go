@@ -63,24 +63,31 @@ func (inst *Installer) ParseFlags() {
 		errln("Usage:")
 		errln("")
 		errf("  %s -h\n", execName)
-		errf("  %s (status|install|remove) [-verbose] [-tmpdir] [-dir] [-tags] [-skip-tags]\n", execName)
-		errf("  %s build [-x file] [dir...]\n", execName)
+		errf("  %s (status|install|remove|interactive) [-verbose] [-tmpdir] [-dir] [-tags] [-skip-tags] [-restore] [-archive] [-verify-key file] [-lazy] [-payload path] [-facts-dir dir] [-definition file]\n", execName)
+		errf("  %s build [-x files] [-targets platforms [-pkg path]] [-fetch] [-bundle] [-include patterns] [-sign-key file] [-manifest file] [-definition file] [dir...]\n", execName)
 		errf("  %s rerun\n", execName)
+		errf("  %s store (list|show|diff|gc) [-dir] [path...]\n", execName)
+		errf("  %s facts [-facts-dir dir]\n", execName)
+		errf("  %s modules [-schema] [-markdown] [module...]\n", execName)
 		errln("")
 		errln("Commands:")
 		errln("")
 		errln("  status    Show the current installation.")
 		errln("  install   Run the installer.")
 		errln("  remove    Reverse the installation process.")
+		errln("  interactive  Browse the tasks and their status, and pick which to install or remove.")
 		errln("  rerun     Start a command prompt to search/view/edit/run previous commands.")
 		errln("  build     Add file resources to executable to build a stand-alone installer.")
+		errln("  store     Inspect and clean up the backup store.")
+		errln("  facts     Print the facts about this system (as JSON).")
+		errln("  modules   List the modules for installer definitions, with their JSON schemas.")
 		errln("")
 		errln("For details on individual command options, run './installer <cmd> -h'.")
 		errln("")
 		flag.PrintDefaults()
 	}
 
-	// Options for the "run" commands: install, remove, status.
+	// Options for the "run" commands: install, remove, status, interactive.
 	runFlag := flag.NewFlagSet("run", flag.ExitOnError)
 	flagMerger := NewFlagMerger()
 	for _, f := range inst.UserFlags {
@@ -91,11 +98,18 @@ func (inst *Installer) ParseFlags() {
 	dir := runFlag.String("dir", "~/.genesis", "Storage directory for data. Defaults to ~/.genesis")
 	doTags := runFlag.String("tags", "", "Specify comma-separated tags to run.  Defaults to all.")
 	skipTags := runFlag.String("skip-tags", "", "Specify comma-separated tags to skip.  Defaults to none.")
+	restore := runFlag.String("restore", "original", "On remove, which file backups to restore: original, previous, or a generation number.")
+	archive := runFlag.Bool("archive", false, "Keep the store in a single archive file (store.zip) instead of a directory.")
+	payloadPath := runFlag.String("payload", "", "Read files from this bundle or directory, instead of the executable (or the .bundle next to it).")
+	lazy := runFlag.Bool("lazy", false, "Only extract the files needed by the selected tasks (see -tags), just before running them.")
+	verifyKey := runFlag.String("verify-key", "", "Refuse to run unless the archive is signed by this ed25519 public key (PEM file).")
+	definition := runFlag.String("definition", "", "Installer definition file (YAML or TOML), for installers which load one (e.g. the genesis command).")
+	factsDir := runFlag.String("facts-dir", DefaultFactsDir, "Directory of drop-in fact files (JSON or key=value), or executables which print them.")
 	runFlag.Usage = func() {
 		errln("")
 		errln("Usage:")
 		errln("")
-		errf("  %s (status|install|remove) [-verbose] [-tmpdir] [-storedir] [-tags] [-skip-tags]\n", execName)
+		errf("  %s (status|install|remove|interactive) [-verbose] [-tmpdir] [-dir] [-tags] [-skip-tags] [-restore] [-archive] [-verify-key file] [-lazy] [-payload path] [-facts-dir dir] [-definition file]\n", execName)
 		errln("")
 		errln("Genesis options:")
 		errln("")
@@ -119,18 +133,32 @@ func (inst *Installer) ParseFlags() {
 	}
 
 	buildFlag := flag.NewFlagSet("build", flag.ExitOnError)
-	xName := buildFlag.String("x", "", "Specify the executable to append zip file to.  Useful for cross compiling.")
+	xName := buildFlag.String("x", "", "Specify the executable(s) to append zip file to (comma-separated).  Useful for cross compiling.")
+	targets := buildFlag.String("targets", "", "Comma-separated platforms (GOOS/GOARCH, or GOOS/arm/GOARM) to compile -pkg for, and build installers from.")
+	pkg := buildFlag.String("pkg", ".", "Go package of the installer, for -targets.")
+	fetch := buildFlag.Bool("fetch", false, "Download remote files (e.g. HttpGet urls) and add them to the archive.")
+	bundle := buildFlag.Bool("bundle", false, "Write the archive to a separate .bundle file, instead of appending it to the executable.")
+	include := buildFlag.String("include", "", "Comma-separated list of extra files, directories or glob patterns to add to the archive.")
+	manifest := buildFlag.String("manifest", "", "Also write the archive manifest (JSON) to this file.")
+	signKey := buildFlag.String("sign-key", "", "Sign the archive manifest with this ed25519 private key (PEM file).")
+	buildFlag.StringVar(definition, "definition", "", "Installer definition file (YAML or TOML) to build from, and add to the archive.")
 	buildFlag.Usage = func() {
 		errln("")
 		errln("Builds the self-extracting file from the executable. Packages up")
 		errln("needed files (and only needed files) as a zip archive and appends")
 		errln("to binary executable.  Optionally specify:")
-		errln("  - the name of the binary (useful for cross compiling)")
+		errln("  - the names of the binaries (useful for cross compiling)")
+		errln("  - platforms to compile for, with 'go build', e.g. -targets linux/amd64,linux/arm/7,linux/arm64")
 		errln("  - a list of directories to collect files from")
+		errln("  - to download remote files into the archive, for offline installs")
+		errln("  - a key to sign the archive with (see -verify-key on install)")
+		errln("  - to write the archive to a separate .bundle file (for binaries which are signed or stripped)")
 		errln("")
 		errln("Usage:")
 		errln("")
-		errf("  %s build [-x file] [list of directories]\n", execName)
+		errf("  %s build [-x files] [-targets platforms [-pkg path]] [-fetch] [-bundle] [-include patterns] [-sign-key file] [-manifest file] [-definition file] [list of directories]\n", execName)
+		errln("")
+		buildFlag.PrintDefaults()
 		errln("")
 	}
 
@@ -150,6 +178,57 @@ func (inst *Installer) ParseFlags() {
 		errln("")
 	}
 
+	storeFlag := flag.NewFlagSet("store", flag.ExitOnError)
+	storeFlag.StringVar(dir, "dir", "~/.genesis", "Storage directory for data. Defaults to ~/.genesis")
+	storeFlag.BoolVar(archive, "archive", false, "Use a store kept in a single archive file (store.zip).")
+	storeFlag.StringVar(definition, "definition", "", "Installer definition file (YAML or TOML), for gc.")
+	dryRun := storeFlag.Bool("dry-run", false, "For gc, only report what would be removed.")
+	storeFlag.Usage = func() {
+		errln("")
+		errln("Inspect and clean up the backup store.")
+		errln("")
+		errln("Usage:")
+		errln("")
+		errf("  %s store list [-dir]                   List store entries, their files and tasks.\n", execName)
+		errf("  %s store show [-dir] path...           Show the backups (or patch) of a file.\n", execName)
+		errf("  %s store diff [-dir] path [generation] Diff a backup against the live file.\n", execName)
+		errf("  %s store gc [-dir] [-dry-run]          Remove entries for tasks no longer in the installer.\n", execName)
+		errln("")
+		storeFlag.PrintDefaults()
+		errln("")
+	}
+
+	factsFlag := flag.NewFlagSet("facts", flag.ExitOnError)
+	factsFlag.StringVar(factsDir, "facts-dir", DefaultFactsDir, "Directory of drop-in fact files (JSON or key=value), or executables which print them.")
+	factsFlag.Usage = func() {
+		errln("")
+		errln("Print the facts gathered about this system as JSON, including")
+		errln("custom facts (from the installer and from the drop-in directory).")
+		errln("")
+		errln("Usage:")
+		errln("")
+		errf("  %s facts [-facts-dir dir]\n", execName)
+		errln("")
+		factsFlag.PrintDefaults()
+		errln("")
+	}
+
+	modulesFlag := flag.NewFlagSet("modules", flag.ExitOnError)
+	schema := modulesFlag.Bool("schema", false, "Print the JSON schema of installer definition files.")
+	markdown := modulesFlag.Bool("markdown", false, "Print the documentation of the modules as markdown.")
+	modulesFlag.Usage = func() {
+		errln("")
+		errln("List the modules which can be used in installer definitions.")
+		errln("")
+		errln("Usage:")
+		errln("")
+		errf("  %s modules                  List the modules.\n", execName)
+		errf("  %s modules module...        Print the JSON schema of the modules.\n", execName)
+		errf("  %s modules -markdown        Print the documentation of the modules.\n", execName)
+		errf("  %s modules -schema          Print the JSON schema of definition files.\n", execName)
+		errln("")
+	}
+
 	// Print help screen if no arguments are given.
 	if len(os.Args) <= 1 {
 		flag.Usage()
@@ -161,13 +240,31 @@ func (inst *Installer) ParseFlags() {
 
 	// Parse the subcommand options.
 	switch cmd {
-	case "install", "remove", "status":
+	case "install", "remove", "status", "interactive":
 		runFlag.Parse(os.Args[2:])
 	case "build":
 		buildFlag.Parse(os.Args[2:])
 		inst.BuildDirs = buildFlag.Args()
 	case "rerun":
 		rerunFlag.Parse(os.Args[2:])
+	case "store":
+		if len(os.Args) < 3 {
+			storeFlag.Usage()
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "help", "-h", "-help", "--help":
+			storeFlag.Usage()
+			os.Exit(0)
+		}
+		storeFlag.Parse(os.Args[3:])
+		inst.StoreArgs = append([]string{os.Args[2]}, storeFlag.Args()...)
+		inst.DryRun = *dryRun
+	case "facts":
+		factsFlag.Parse(os.Args[2:])
+	case "modules":
+		modulesFlag.Parse(os.Args[2:])
+		inst.ModulesArgs = modulesFlag.Args()
 	default:
 		flag.Usage()
 		os.Exit(1)
@@ -177,7 +274,23 @@ func (inst *Installer) ParseFlags() {
 	inst.Verbose = *verbose
 	inst.DoTags = *doTags
 	inst.SkipTags = *skipTags
+	inst.Restore = *restore
 	inst.ExecName = *xName
+	inst.Fetch = *fetch
+	inst.Archive = *archive
+	inst.SignKey = *signKey
+	inst.ManifestFile = *manifest
+	inst.Include = *include
+	inst.Targets = *targets
+	inst.Package = *pkg
+	inst.VerifyKey = *verifyKey
+	inst.Lazy = *lazy
+	inst.Payload = *payloadPath
+	inst.Bundle = *bundle
+	inst.FactsDir = *factsDir
+	inst.Definition = *definition
+	inst.Schema = *schema
+	inst.Markdown = *markdown
 
 	genesis.Tmpdir, _ = ioutil.TempDir(*tmpdir, "genesis")
 	inst.Dir = genesis.ExpandHome(*dir)
@@ -0,0 +1,89 @@
+package installer
+
+import (
+	"github.com/wx13/genesis"
+)
+
+// ForEach is a type of genesis.Doer.  It makes a Doer for each item in a
+// list (e.g. users, or network interfaces), using the Make function.  Each
+// item's Doer is a section named "Name: item", so it is shown grouped in
+// the output, and has its own stable tag for -tags/-skip-tags.
+type ForEach struct {
+	Name  string
+	Items []string
+	Make  func(item string) genesis.Doer
+
+	sections []genesis.Doer // made once, by NewForEach
+}
+
+// NewForEach makes the Doers for the items (once).
+func NewForEach(name string, items []string, maker func(item string) genesis.Doer) *ForEach {
+	forEach := &ForEach{
+		Name:  name,
+		Items: items,
+		Make:  maker,
+	}
+	forEach.sections = forEach.makeSections()
+	return forEach
+}
+
+// ForEachFact is like NewForEach, but the items are computed from the
+// facts about the target system.  The build command uses the facts of
+// the build machine, which may have different items: add any other
+// files needed by the Doers with -include.
+func (inst *Installer) ForEachFact(name string, items func(facts genesis.Facts) []string, maker func(item string) genesis.Doer) *ForEach {
+	return NewForEach(name, items(inst.Facts), maker)
+}
+
+// doers lists the section for each item.
+func (forEach ForEach) doers() []genesis.Doer {
+	if forEach.sections != nil {
+		return forEach.sections
+	}
+	return forEach.makeSections()
+}
+
+// makeSections makes the section for each item.  This is only done
+// again for a ForEach which was not made by NewForEach.
+func (forEach ForEach) makeSections() []genesis.Doer {
+	doers := []genesis.Doer{}
+	for _, item := range forEach.Items {
+		doers = append(doers, Section{
+			Name:  forEach.Name + ": " + item,
+			Tasks: []genesis.Doer{forEach.Make(item)},
+		})
+	}
+	return doers
+}
+
+func (forEach ForEach) section() Section {
+	return Section{Name: forEach.Name, Tasks: forEach.doers()}
+}
+
+func (forEach ForEach) Children(all bool) []genesis.Doer {
+	return forEach.doers()
+}
+
+func (forEach ForEach) Selector() (string, []string, bool) {
+	return forEach.Name, nil, true
+}
+
+func (forEach ForEach) ID() string {
+	return forEach.section().ID()
+}
+
+func (forEach ForEach) Files() []string {
+	return forEach.section().Files()
+}
+
+func (forEach ForEach) Status() (genesis.Status, error) {
+	return forEach.section().Status()
+}
+
+func (forEach ForEach) Do() (bool, error) {
+	return forEach.section().Do()
+}
+
+func (forEach ForEach) Undo() (bool, error) {
+	return forEach.section().Undo()
+}
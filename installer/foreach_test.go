@@ -0,0 +1,48 @@
+package installer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func TestForEach(t *testing.T) {
+
+	defer setTags(nil, nil)
+	made := 0
+	forEach := NewForEach("Users", []string{"alice", "bob"}, func(user string) genesis.Doer {
+		made++
+		return Task{testModule{Name: user, File: "/home/" + user}}
+	})
+
+	tests := []struct {
+		doTags []string
+		files  []string
+	}{
+		{nil, []string{"/home/alice", "/home/bob"}},
+		{[]string{"users"}, []string{"/home/alice", "/home/bob"}},
+		{[]string{"Users: bob"}, []string{"/home/bob"}},
+		{[]string{"Users/Users: alice"}, []string{"/home/alice"}},
+		{[]string{"users/*bob"}, []string{"/home/bob"}},
+		{[]string{"other"}, []string{}},
+	}
+	for _, test := range tests {
+		setTags(test.doTags, nil)
+		files := selectedFiles([]genesis.Doer{forEach})
+		if !reflect.DeepEqual(files, test.files) {
+			t.Errorf("Tags %v should select %v, not %v", test.doTags, test.files, files)
+		}
+	}
+
+	setTags(nil, nil)
+	if len(TaskTags([]genesis.Doer{forEach})) != 2 {
+		t.Error("Each item should have a task.")
+	}
+	forEach.Status()
+	forEach.Files()
+	if made != 2 {
+		t.Error("Make should be called once per item, but was called", made, "times.")
+	}
+
+}
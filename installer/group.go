@@ -0,0 +1,49 @@
+package installer
+
+import (
+	"github.com/wx13/genesis"
+)
+
+// group is implemented by Doers which are made of other Doers (Section,
+// Tagged, Switch, IfThen, Conditional and ForEach), so that the installer
+// can walk them without knowing their types.
+type group interface {
+	// Children lists the Doers within this one.  With all set, it also
+	// lists those which never run (the other cases of a Switch).
+	Children(all bool) []genesis.Doer
+	// Selector gives the name and user-assigned tags by which the group
+	// is selected with -tags and -skip-tags (see skipTagged).  ok is
+	// false if only the Doers within it are selected.
+	Selector() (name string, tags []string, ok bool)
+}
+
+// eachDoer calls fn for each Doer in a list, with the Doers within it
+// (nil if it is not a group), and whether it will run (see SkipID).  fn
+// is called with DoTags and the section path set up as when the Doer
+// runs, so that it can walk the Doers within it in turn.
+func eachDoer(doers []genesis.Doer, all bool, fn func(doer genesis.Doer, children []genesis.Doer, skip string)) {
+	for _, doer := range doers {
+		g, ok := doer.(group)
+		if !ok {
+			fn(doer, nil, SkipID(doer.ID()))
+			continue
+		}
+		name, tags, selected := g.Selector()
+		skip := "pass"
+		if selected {
+			skip = skipTagged(doer.ID(), name, tags)
+		}
+		doTags := DoTags
+		if skip == "do" {
+			doTags = EmptyDoTags()
+		}
+		children := g.Children(all)
+		if children == nil {
+			children = []genesis.Doer{}
+		}
+		enterSection(name)
+		fn(doer, children, skip)
+		leaveSection(name)
+		RestoreDoTags(doTags)
+	}
+}
@@ -19,6 +19,14 @@ func (ifthen IfThen) Files() []string {
 	return append(ifthen.If.Files(), ifthen.Then.Files()...)
 }
 
+func (ifthen IfThen) Children(all bool) []genesis.Doer {
+	return []genesis.Doer{ifthen.If, ifthen.Then}
+}
+
+func (ifthen IfThen) Selector() (string, []string, bool) {
+	return "", nil, true
+}
+
 func (ifthen IfThen) Status() (genesis.Status, error) {
 	skip := SkipID(ifthen.ID())
 	if skip == "skip" {
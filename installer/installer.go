@@ -4,18 +4,16 @@
 package installer
 
 import (
-	"archive/zip"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"strings"
 
-	"github.com/kardianos/osext"
-
 	"github.com/wx13/genesis"
 	"github.com/wx13/genesis/store"
 )
@@ -28,17 +26,44 @@ var DoTags, SkipTags []string
 // Installer is a wrapper around modules to provide a nice
 // interface for building an installer.
 type Installer struct {
-	Cmd       string
-	Verbose   bool
-	Facts     genesis.Facts
-	Tasks     []genesis.Doer
-	Dir       string
-	Gendir    string
-	DoTags    string
-	SkipTags  string
-	UserFlags []*flag.FlagSet
-	ExecName  string
-	BuildDirs []string
+	Cmd          string
+	Verbose      bool
+	Facts        genesis.Facts
+	Tasks        []genesis.Doer
+	Dir          string
+	Gendir       string
+	DoTags       string
+	SkipTags     string
+	Restore      string
+	Archive      bool
+	SignKey      string
+	ManifestFile string
+	Include      string
+	Targets      string
+	Package      string
+	VerifyKey    string
+	UserFlags    []*flag.FlagSet
+	ExecName     string
+	BuildDirs    []string
+	Fetch        bool
+	StoreArgs    []string
+	DryRun       bool
+	Lazy         bool
+
+	Payload  string
+	Bundle   bool
+	FactsDir string
+
+	Definition     string
+	definitionFile string // read by build, to add to the archive
+
+	ModulesArgs []string
+	Schema      bool
+	Markdown    bool
+
+	payload  []payloadFile // until extracted
+	manifest *Manifest     // nil for a directory without one
+	closer   io.Closer
 }
 
 // New creates a new installer object.
@@ -66,11 +91,24 @@ func (inst *Installer) Init() *Installer {
 		}
 	}
 
+	// Build and store need the facts to expand ForEachFact Doers.
 	if inst.Cmd == "build" {
+		inst.gatherFacts()
+		return inst
+	}
+
+	if inst.Cmd == "store" {
+		inst.openStore()
+		inst.gatherFacts()
 		return inst
 	}
 
-	if inst.Cmd != "install" && inst.Cmd != "remove" && inst.Cmd != "status" {
+	if inst.Cmd == "facts" {
+		inst.gatherFacts()
+		return inst
+	}
+
+	if inst.Cmd != "install" && inst.Cmd != "remove" && inst.Cmd != "status" && inst.Cmd != "interactive" {
 		return inst
 	}
 
@@ -81,13 +119,8 @@ func (inst *Installer) Init() *Installer {
 		DoTags = strings.Split(inst.DoTags, ",")
 	}
 
-	var err error
-	storedir := filepath.Join(inst.Dir, "store")
-	genesis.Store, err = store.New(storedir)
-	if err != nil {
-		fmt.Println("Cannot access store directory.", err)
-		os.Exit(1)
-	}
+	inst.openStore()
+	genesis.Store.Restore = inst.Restore
 
 	if inst.Cmd == "install" || inst.Cmd == "remove" {
 		err := SaveHistory(inst.Dir, os.Args)
@@ -96,59 +129,65 @@ func (inst *Installer) Init() *Installer {
 		}
 	}
 
-	inst.Facts = genesis.GatherFacts()
-	inst.extractFiles()
+	inst.gatherFacts()
+	err := inst.openArchive()
+	if err == nil && (!inst.Lazy || inst.Cmd == "interactive") {
+		err = inst.extractFiles(nil)
+	}
+	if err != nil {
+		fmt.Println("Refusing to run: cannot extract files.", err)
+		os.RemoveAll(genesis.Tmpdir)
+		os.Exit(1)
+	}
 
 	return inst
 
 }
 
-func (inst *Installer) extractFiles() error {
-
-	filename, _ := osext.Executable()
-
-	zipRdr, err := zip.OpenReader(filename)
+// openStore opens the store, either as a directory or a single
+// archive file within inst.Dir.
+func (inst *Installer) openStore() {
+	var err error
+	if inst.Archive {
+		genesis.Store, err = store.NewArchive(filepath.Join(inst.Dir, "store.zip"))
+	} else {
+		genesis.Store, err = store.New(filepath.Join(inst.Dir, "store"))
+	}
 	if err != nil {
-		fmt.Println("Couldn't extract files.", err, filename)
-		return err
+		fmt.Println("Cannot access store.", err)
+		os.Exit(1)
 	}
-	for _, file := range zipRdr.File {
-		dest := filepath.Join(genesis.Tmpdir, file.Name)
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(dest, file.FileInfo().Mode().Perm())
-			continue
-		}
-		os.MkdirAll(filepath.Dir(dest), 0755)
-		perms := file.FileInfo().Mode().Perm()
-		out, err := os.OpenFile(dest, os.O_CREATE|os.O_RDWR, perms)
-		if err != nil {
-			continue
-		}
-		rc, err := file.Open()
-		if err != nil {
-			continue
-		}
-		_, err = io.CopyN(out, rc, file.FileInfo().Size())
-		if err != nil {
-			continue
-		}
-		rc.Close()
-		out.Close()
-
-		mtime := file.FileInfo().ModTime()
-		err = os.Chtimes(dest, mtime, mtime)
-		if err != nil {
-			continue
-		}
+}
 
+// closeStore writes out any changes to the store.  It may be called
+// more than once.
+func (inst *Installer) closeStore() {
+	if genesis.Store == nil {
+		return
 	}
-
-	return nil
+	err := genesis.Store.Close()
+	if err != nil {
+		fmt.Println("Error saving store:", err)
+	}
+	genesis.Store = nil
 }
 
 // Done finishes up the installer process.
 func (inst *Installer) Done() {
 
+	defer inst.closeStore()
+
+	// With -lazy, only now do we know which files are needed.
+	if inst.payload != nil {
+		names := lazyNames(selectedFiles(inst.Tasks), genesis.Tmpdir)
+		err := inst.extractFiles(names)
+		if err != nil {
+			fmt.Println("Refusing to run: cannot extract files.", err)
+			os.RemoveAll(genesis.Tmpdir)
+			os.Exit(1)
+		}
+	}
+
 	switch inst.Cmd {
 
 	case "remove":
@@ -167,8 +206,45 @@ func (inst *Installer) Done() {
 			task.Status()
 		}
 
+	case "interactive":
+		inst.Interactive()
+		os.RemoveAll(genesis.Tmpdir)
+		return
+
 	case "build":
-		inst.Build()
+		err := inst.Build()
+		os.RemoveAll(genesis.Tmpdir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+
+	case "store":
+		err := inst.StoreCmd()
+		inst.closeStore() // before exiting, which skips deferred calls
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+
+	case "modules":
+		err := inst.ModulesCmd()
+		os.RemoveAll(genesis.Tmpdir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+
+	case "facts":
+		err := inst.PrintFacts()
+		os.RemoveAll(genesis.Tmpdir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
 		return
 
 	}
@@ -184,24 +260,74 @@ func (inst *Installer) CleanUp() {
 	os.RemoveAll(genesis.Tmpdir)
 }
 
+// SkipID decides whether to run a Doer, given its ID: "skip" if it is
+// selected by SkipTags, "do" if it is selected by DoTags (or there are
+// none), and "pass" if not (but the Doers within it may be).
 func SkipID(id string) string {
-	id = genesis.StringHash(id)
-	for _, tag := range SkipTags {
-		if id == tag {
-			return "skip"
-		}
+	return skipTagged(id, "", nil)
+}
+
+// skipTagged is like SkipID, for a Doer with a name and user-assigned
+// tags.  A tag selects a Doer if it matches the Doer's hash tag, any of
+// its tags, its name, or its path (the names of the sections it is in,
+// and its own name, joined with "/").  Tags may be glob patterns (such
+// as "network/*"), and are matched without regard to case.  The name
+// defaults to the hash tag.
+func skipTagged(id, name string, tags []string) string {
+	hash := genesis.StringHash(id)
+	if name == "" {
+		name = hash
+	}
+	full := name
+	if len(sectionPath) > 0 {
+		full = strings.Join(sectionPath, "/") + "/" + name
+	}
+	names := append([]string{hash, name, full}, tags...)
+	if matchTags(SkipTags, names) {
+		return "skip"
 	}
 	if len(DoTags) == 0 {
 		return "do"
 	}
-	for _, tag := range DoTags {
-		if id == tag {
-			return "do"
-		}
+	if matchTags(DoTags, names) {
+		return "do"
 	}
 	return "pass"
 }
 
+func matchTags(patterns, names []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if len(pattern) == 0 {
+			continue
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			match, err := path.Match(pattern, name)
+			if match || (err != nil && pattern == name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sectionPath holds the names of the sections we are in, for
+// matching tags against paths.
+var sectionPath []string
+
+func enterSection(name string) {
+	if len(name) > 0 {
+		sectionPath = append(sectionPath, name)
+	}
+}
+
+func leaveSection(name string) {
+	if len(name) > 0 {
+		sectionPath = sectionPath[:len(sectionPath)-1]
+	}
+}
+
 func EmptyDoTags() []string {
 	doTags := make([]string, len(DoTags))
 	copy(doTags, DoTags)
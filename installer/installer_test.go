@@ -0,0 +1,108 @@
+package installer
+
+import (
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+// testModule is a module which needs a file, and passes once installed.
+type testModule struct {
+	Name      string
+	File      string
+	Pass      bool
+	Installed *int // counts installs
+}
+
+func (m testModule) ID() string { return "test: " + m.Name }
+
+func (m testModule) Files() []string {
+	if len(m.File) == 0 {
+		return []string{}
+	}
+	return []string{m.File}
+}
+
+func (m testModule) Install() (string, error) {
+	if m.Installed != nil {
+		*m.Installed++
+	}
+	return "Installed.", nil
+}
+
+func (m testModule) Remove() (string, error) { return "Removed.", nil }
+
+func (m testModule) Status() (genesis.Status, string, error) {
+	if m.Pass || (m.Installed != nil && *m.Installed > 0) {
+		return genesis.StatusPass, "Installed.", nil
+	}
+	return genesis.StatusFail, "Not installed.", nil
+}
+
+// setTags sets -tags and -skip-tags, as if at the top level.
+func setTags(doTags, skipTags []string) {
+	DoTags, SkipTags = doTags, skipTags
+	sectionPath = nil
+}
+
+func TestMatchTags(t *testing.T) {
+
+	tests := []struct {
+		patterns []string
+		names    []string
+		match    bool
+	}{
+		{[]string{"network"}, []string{"Network"}, true},
+		{[]string{"NET*"}, []string{"network"}, true},
+		{[]string{" net* "}, []string{"network"}, true},
+		{[]string{"net/*"}, []string{"net/wifi"}, true},
+		{[]string{"net/*"}, []string{"net/wifi/scan"}, false},
+		{[]string{"net/*/scan"}, []string{"net/wifi/scan"}, true},
+		{[]string{"[bad"}, []string{"[bad"}, true},
+		{[]string{"", " "}, []string{"x"}, false},
+		{[]string{"a", "b"}, []string{"c", "b"}, true},
+		{[]string{}, []string{"a"}, false},
+	}
+	for _, test := range tests {
+		if matchTags(test.patterns, test.names) != test.match {
+			t.Errorf("Patterns %v matching %v should be %t", test.patterns, test.names, test.match)
+		}
+	}
+
+}
+
+func TestSkipTagged(t *testing.T) {
+
+	defer setTags(nil, nil)
+	hash := genesis.StringHash("id")
+
+	tests := []struct {
+		doTags   []string
+		skipTags []string
+		name     string
+		tags     []string
+		skip     string
+	}{
+		{nil, nil, "Wifi", nil, "do"},
+		{[]string{"other"}, nil, "Wifi", nil, "pass"},
+		{[]string{"wifi"}, nil, "Wifi", nil, "do"},
+		{[]string{"net/wifi"}, nil, "Wifi", nil, "do"},
+		{[]string{"net/*"}, nil, "Wifi", nil, "do"},
+		{[]string{hash}, nil, "Wifi", nil, "do"},
+		{[]string{"net/" + hash}, nil, "", nil, "do"},
+		{[]string{"reboot"}, nil, "Wifi", []string{"reboot"}, "do"},
+		{nil, []string{"net/*"}, "Wifi", nil, "skip"},
+		{nil, []string{"re*"}, "Wifi", []string{"reboot"}, "skip"},
+		{[]string{"wifi"}, []string{"wifi"}, "Wifi", nil, "skip"},
+	}
+	for _, test := range tests {
+		setTags(test.doTags, test.skipTags)
+		enterSection("Net")
+		skip := skipTagged("id", test.name, test.tags)
+		if skip != test.skip {
+			t.Errorf("Tags %v, skip tags %v: %s %v should be %q, not %q",
+				test.doTags, test.skipTags, test.name, test.tags, test.skip, skip)
+		}
+	}
+
+}
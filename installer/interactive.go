@@ -0,0 +1,419 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/peterh/liner"
+
+	"github.com/wx13/genesis"
+)
+
+// treeNode is a line in the interactive task tree: a Task (or another
+// Doer which does not contain Tasks), or a Doer which contains others.
+type treeNode struct {
+	title    string
+	tag      string // hash tag
+	key      string // for selecting with -tags: the path of a section, or the hash tag
+	depth    int
+	task     *Task
+	children []*treeNode
+	selected bool // for nodes without children
+	status   genesis.Status
+	msg      string
+}
+
+// Interactive runs the "interactive" subcommand.  It shows the tasks
+// with their status, and lets the operator pick which to install or
+// remove, without having to know any tags.
+func (inst *Installer) Interactive() {
+
+	nodes := buildTree(inst.Tasks, 0)
+	list := flattenTree(nodes)
+	refreshTree(nodes)
+
+	fmt.Println("")
+	fmt.Println("    Select tasks, then install or remove them.  Type 'help' for commands.")
+	printTree(list)
+
+	lnr := liner.NewLiner()
+	defer lnr.Close()
+	lnr.SetCtrlCAborts(true)
+
+	for {
+		line, err := lnr.Prompt("genesis> ")
+		if err != nil {
+			fmt.Println("")
+			return
+		}
+		lnr.AppendHistory(line)
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			printTree(list)
+			continue
+		}
+
+		cmd, args := words[0], words[1:]
+		switch cmd {
+		case "list", "ls", "l":
+			printTree(list)
+		case "toggle", "t":
+			picked, err := parseNumbers(args, len(list))
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			for _, k := range picked {
+				list[k].setSelected(!list[k].isSelected())
+			}
+			printTree(list)
+		case "all":
+			setSelected(nodes, true)
+			printTree(list)
+		case "none":
+			setSelected(nodes, false)
+			printTree(list)
+		case "show", "s":
+			picked, err := parseNumbers(args, len(list))
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			for _, k := range picked {
+				showNode(list[k])
+			}
+		case "status", "refresh":
+			refreshTree(nodes)
+			printTree(list)
+		case "install", "remove":
+			tags := selectedTags(nodes)
+			if len(tags) == 0 {
+				fmt.Println("Nothing is selected.")
+				continue
+			}
+			answer, err := lnr.Prompt(fmt.Sprintf("%s %d selected task(s)? [y/N] ", cmd, countSelected(nodes)))
+			if err != nil || !strings.HasPrefix(strings.ToLower(answer), "y") {
+				continue
+			}
+			inst.runSelected(cmd, tags)
+			refreshTree(nodes)
+			printTree(list)
+		case "help", "h", "?":
+			printInteractiveHelp()
+		case "quit", "exit", "q":
+			return
+		default:
+			fmt.Println("Unknown command:", cmd, "(type 'help' for commands)")
+		}
+	}
+
+}
+
+func printInteractiveHelp() {
+	fmt.Println("")
+	fmt.Println("    list                List the tasks (also an empty line).")
+	fmt.Println("    toggle N...         Select or unselect tasks or sections, e.g. 'toggle 3 5-9'.")
+	fmt.Println("    all, none           Select or unselect everything.")
+	fmt.Println("    show N...           Show details of a task, and what remove would restore.")
+	fmt.Println("    status              Check the status of the tasks again.")
+	fmt.Println("    install, remove     Install or remove the selected tasks.")
+	fmt.Println("    quit                Leave.")
+	fmt.Println("")
+}
+
+// runSelected installs or removes the selected tasks, as if run with
+// -tags, and saves the equivalent command in the history (for rerun).
+func (inst *Installer) runSelected(cmd string, tags []string) {
+
+	DoTags, SkipTags = tags, []string{}
+
+	args := append([]string{os.Args[0], cmd}, os.Args[2:]...)
+	err := SaveHistory(inst.Dir, append(args, "-tags", strings.Join(tags, ",")))
+	if err != nil {
+		fmt.Println("Error saving command history:", err)
+	}
+
+	if cmd == "install" {
+		for _, task := range inst.Tasks {
+			task.Do()
+		}
+	} else {
+		for k := len(inst.Tasks) - 1; k >= 0; k-- {
+			inst.Tasks[k].Undo()
+		}
+	}
+
+	ReportSummary()
+	StatusCount.Pass, StatusCount.Fail, StatusCount.Unknown, StatusCount.Done = 0, 0, 0, 0
+
+}
+
+// buildTree makes the nodes for a list of Doers.  Which are selected
+// follows -tags and -skip-tags, by the same rules as the Doers use.
+func buildTree(doers []genesis.Doer, depth int) []*treeNode {
+	nodes := []*treeNode{}
+	eachDoer(doers, false, func(doer genesis.Doer, children []genesis.Doer, skip string) {
+
+		hash := genesis.StringHash(doer.ID())
+		if children == nil {
+			node := &treeNode{
+				title:    firstLine(doer.ID()),
+				tag:      hash,
+				key:      hash,
+				depth:    depth,
+				selected: skip == "do",
+			}
+			if task, ok := doer.(Task); ok {
+				node.task = &task
+			}
+			nodes = append(nodes, node)
+			return
+		}
+
+		// Named groups are keyed by their path, which is stable.
+		name, tags, selected := doer.(group).Selector()
+		title, key := "", hash
+		switch {
+		case len(name) > 0:
+			title = name + "/"
+			full := strings.Join(sectionPath, "/")
+			if !strings.ContainsAny(full, `*?[\,`) {
+				key = full
+			}
+		case selected && len(tags) == 0:
+			title = firstLine(doer.ID())
+		}
+
+		childDepth := depth
+		if len(title) > 0 {
+			childDepth++
+		}
+		kids := buildTree(children, childDepth)
+		if skip == "skip" {
+			setSelected(kids, false)
+		}
+
+		// Unnamed groups, and Tagged Doers, are shown as their contents.
+		if len(title) == 0 {
+			if len(tags) > 0 && len(kids) == 1 {
+				kids[0].title += " [" + strings.Join(tags, ", ") + "]"
+			}
+			nodes = append(nodes, kids...)
+			return
+		}
+		nodes = append(nodes, &treeNode{
+			title:    title,
+			tag:      hash,
+			key:      key,
+			depth:    depth,
+			children: kids,
+			selected: skip == "do",
+		})
+
+	})
+	return nodes
+}
+
+func flattenTree(nodes []*treeNode) []*treeNode {
+	list := []*treeNode{}
+	for _, node := range nodes {
+		list = append(list, node)
+		list = append(list, flattenTree(node.children)...)
+	}
+	return list
+}
+
+func (node *treeNode) isSelected() bool {
+	if len(node.children) == 0 {
+		return node.selected
+	}
+	for _, child := range node.children {
+		if !child.isSelected() {
+			return false
+		}
+	}
+	return true
+}
+
+func (node *treeNode) anySelected() bool {
+	if len(node.children) == 0 {
+		return node.selected
+	}
+	for _, child := range node.children {
+		if child.anySelected() {
+			return true
+		}
+	}
+	return false
+}
+
+func (node *treeNode) setSelected(selected bool) {
+	node.selected = selected
+	setSelected(node.children, selected)
+}
+
+func setSelected(nodes []*treeNode, selected bool) {
+	for _, node := range nodes {
+		node.setSelected(selected)
+	}
+}
+
+// selectedTags lists the tags which select the selected nodes: a node
+// which is entirely selected is run as a whole.
+func selectedTags(nodes []*treeNode) []string {
+	tags := []string{}
+	for _, node := range nodes {
+		if node.isSelected() {
+			tags = append(tags, node.key)
+		} else {
+			tags = append(tags, selectedTags(node.children)...)
+		}
+	}
+	return tags
+}
+
+func countSelected(nodes []*treeNode) int {
+	count := 0
+	for _, node := range nodes {
+		if len(node.children) == 0 && node.selected {
+			count++
+		}
+		count += countSelected(node.children)
+	}
+	return count
+}
+
+// refreshTree checks the status of each Task.  Other Doers take the
+// worst status of their contents.
+func refreshTree(nodes []*treeNode) genesis.Status {
+	worst := genesis.StatusPass
+	for _, node := range nodes {
+		switch {
+		case node.task != nil:
+			status, msg, err := node.task.Module.Status()
+			node.status, node.msg = status, msg
+			if err != nil {
+				node.msg = fmt.Sprintf("%s %v", msg, err)
+			}
+		case len(node.children) > 0:
+			node.status = refreshTree(node.children)
+		default:
+			node.status = genesis.StatusUnknown
+		}
+		if node.status == genesis.StatusFail {
+			worst = node.status
+		}
+		if node.status == genesis.StatusUnknown && worst == genesis.StatusPass {
+			worst = node.status
+		}
+	}
+	return worst
+}
+
+func printTree(list []*treeNode) {
+	fmt.Println("")
+	for k, node := range list {
+		check := "[ ]"
+		if node.isSelected() {
+			check = "[x]"
+		} else if node.anySelected() {
+			check = "[-]"
+		}
+		status := "\033[33m ?? \033[0m"
+		switch node.status {
+		case genesis.StatusPass:
+			status = "\033[32mPASS\033[0m"
+		case genesis.StatusFail:
+			status = "\033[31mFAIL\033[0m"
+		}
+		title := node.title
+		if len(title) > 72 {
+			title = title[:69] + "..."
+		}
+		indent := strings.Repeat("  ", node.depth)
+		fmt.Printf("  %3d %s %s  %s%s \033[36m%s\033[0m\n", k+1, check, status, indent, title, node.tag)
+	}
+	fmt.Println("")
+}
+
+// showNode prints the details of a node: its full description and
+// status message, and for a Task, the changes remove would undo.
+func showNode(node *treeNode) {
+
+	fmt.Println("")
+	fmt.Println("   ", "\033[36m"+node.tag+"\033[0m", node.title)
+	if node.task == nil {
+		fmt.Printf("    %d of %d task(s) selected\n", countSelected(node.children), len(flattenTree(node.children)))
+		return
+	}
+	for _, line := range strings.Split(node.task.ID(), "\n")[1:] {
+		fmt.Println("     ", line)
+	}
+	if len(node.msg) > 0 {
+		fmt.Println("      status:", node.msg)
+	}
+	for _, file := range node.task.Files() {
+		fmt.Println("      file:  ", file)
+	}
+
+	if genesis.Store == nil {
+		return
+	}
+	entries, err := genesis.Store.Entries()
+	if err != nil {
+		fmt.Println("   ", err)
+		return
+	}
+	found := false
+	for _, entry := range entries {
+		for _, task := range entry.Tasks {
+			if task.Tag != node.tag {
+				continue
+			}
+			found = true
+			printEntry(entry)
+			err = diffEntry(entry, nil)
+			if err != nil {
+				fmt.Println("   ", err)
+			}
+			break
+		}
+	}
+	if !found {
+		fmt.Println("")
+		fmt.Println("    No changes by this task are in the store.")
+	}
+	fmt.Println("")
+
+}
+
+// parseNumbers reads the node numbers (counting from 1), and ranges
+// such as "3-7", returning indexes (counting from 0).
+func parseNumbers(args []string, n int) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errors.New("which ones? (e.g. 3, or 5-9)")
+	}
+	picked := []int{}
+	for _, arg := range args {
+		first, last := arg, arg
+		if k := strings.Index(arg, "-"); k > 0 {
+			first, last = arg[:k], arg[k+1:]
+		}
+		a, err1 := strconv.Atoi(first)
+		b, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || a < 1 || b > n || a > b {
+			return nil, fmt.Errorf("no such task: %s", arg)
+		}
+		for k := a; k <= b; k++ {
+			picked = append(picked, k-1)
+		}
+	}
+	return picked, nil
+}
+
+func firstLine(s string) string {
+	return strings.Split(s, "\n")[0]
+}
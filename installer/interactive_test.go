@@ -0,0 +1,57 @@
+package installer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func TestSelectedTags(t *testing.T) {
+
+	leaf := func(key string, selected bool) *treeNode {
+		return &treeNode{key: key, selected: selected}
+	}
+	group := func(key string, children ...*treeNode) *treeNode {
+		return &treeNode{key: key, children: children}
+	}
+
+	tests := []struct {
+		nodes []*treeNode
+		tags  []string
+	}{
+		{[]*treeNode{leaf("a", true), leaf("b", false)}, []string{"a"}},
+		{[]*treeNode{group("S", leaf("a", true), leaf("b", true))}, []string{"S"}},
+		{[]*treeNode{group("S", leaf("a", true), leaf("b", false))}, []string{"a"}},
+		{[]*treeNode{group("S", group("S/T", leaf("a", true)), leaf("b", false))}, []string{"S/T"}},
+		{[]*treeNode{group("S", leaf("a", false)), leaf("b", false)}, []string{}},
+	}
+	for k, test := range tests {
+		tags := selectedTags(test.nodes)
+		if !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("Test %d: tags should be %v, not %v", k, test.tags, tags)
+		}
+	}
+
+	// The tags select the same tasks as the tree.
+	defer setTags(nil, nil)
+	doers := []genesis.Doer{
+		Section{Name: "Net", Tasks: []genesis.Doer{
+			Task{testModule{Name: "wifi", File: "wifi"}},
+			Tag(Task{testModule{Name: "eth", File: "eth"}}, "wired"),
+		}},
+		Task{testModule{Name: "apt", File: "apt"}},
+	}
+	apt := genesis.StringHash("test: apt")
+	for _, doTags := range [][]string{{"net"}, {"wired"}, {"net/*"}, {"wired", apt}, {"*"}} {
+		setTags(doTags, nil)
+		want := selectedFiles(doers)
+		nodes := buildTree(doers, 0)
+		setTags(selectedTags(nodes), nil)
+		files := selectedFiles(doers)
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("Tags %v: tree selects %v, not %v", doTags, files, want)
+		}
+	}
+
+}
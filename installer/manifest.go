@@ -0,0 +1,224 @@
+package installer
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// The manifest (and its signature) are stored in the archive under
+// these names, and are not extracted.
+const (
+	manifestName  = "genesis/manifest.json"
+	signatureName = "genesis/manifest.sig"
+)
+
+// Manifest lists the files in an installer's archive, with checksums.
+type Manifest struct {
+	Files []ManifestFile
+}
+
+// ManifestFile describes one file in the archive.
+type ManifestFile struct {
+	Name   string
+	Size   int64
+	Sha256 string
+}
+
+func (manifest Manifest) find(name string) (ManifestFile, bool) {
+	for _, file := range manifest.Files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return ManifestFile{}, false
+}
+
+// print lists the files in the manifest, with their sizes.
+func (manifest Manifest) print(archiveSize int) {
+	fmt.Println("Archive manifest:")
+	total := int64(0)
+	for _, file := range manifest.Files {
+		fmt.Printf("    %10d  %s\n", file.Size, file.Name)
+		total += file.Size
+	}
+	fmt.Printf("    %10d  total in %d file(s); %d bytes compressed\n", total, len(manifest.Files), archiveSize)
+}
+
+// write saves the manifest as a JSON file.
+func (manifest Manifest) write(filename string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// payload writes files into the archive, and keeps the manifest.
+type payload struct {
+	w        *zip.Writer
+	manifest Manifest
+}
+
+func newPayload(w io.Writer, offset int64) *payload {
+	zw := zip.NewWriter(w)
+	zw.SetOffset(offset)
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestCompression)
+	})
+	return &payload{w: zw}
+}
+
+// add compresses a file into the archive.  If info is given, the mode
+// and modification time are recorded.
+func (p *payload) add(name string, body []byte, info os.FileInfo) error {
+	header := &zip.FileHeader{Name: name}
+	if info != nil {
+		var err error
+		header, err = zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+	}
+	header.Method = zip.Deflate
+	f, err := p.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(body)
+	if err != nil {
+		return err
+	}
+	p.manifest.Files = append(p.manifest.Files, ManifestFile{
+		Name:   name,
+		Size:   int64(len(body)),
+		Sha256: fmt.Sprintf("%x", sha256.Sum256(body)),
+	})
+	return nil
+}
+
+// close writes out the manifest, signs it (if there is a key), and
+// finishes the archive.
+func (p *payload) close(key ed25519.PrivateKey) error {
+	data, err := json.MarshalIndent(p.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := p.w.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		f, err = p.w.Create(signatureName)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(ed25519.Sign(key, data))
+		if err != nil {
+			return err
+		}
+	}
+	return p.w.Close()
+}
+
+// readManifest reads the manifest from the payload, and checks its
+// signature if there is a key.
+func readManifest(read func(name string) ([]byte, error), key ed25519.PublicKey) (Manifest, error) {
+
+	manifest := Manifest{}
+	data, err := read(manifestName)
+	if err != nil {
+		return manifest, fmt.Errorf("cannot read archive manifest: %v", err)
+	}
+
+	if key != nil {
+		sig, err := read(signatureName)
+		if err != nil {
+			return manifest, fmt.Errorf("archive is not signed: %v", err)
+		}
+		if !ed25519.Verify(key, data, sig) {
+			return manifest, errors.New("archive signature is not valid")
+		}
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+
+}
+
+func readZipFile(zipRdr *zip.Reader, name string) ([]byte, error) {
+	for _, file := range zipRdr.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// readPrivateKey reads an ed25519 private key from a PEM file, such as
+// one made by "openssl genpkey -algorithm ed25519".
+func readPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", filename)
+	}
+	return edKey, nil
+}
+
+// readPublicKey reads an ed25519 public key from a PEM file, such as
+// one made by "openssl pkey -pubout".
+func readPublicKey(filename string) (ed25519.PublicKey, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", filename)
+	}
+	return edKey, nil
+}
+
+func readPEM(filename string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", filename)
+	}
+	return block, nil
+}
@@ -0,0 +1,150 @@
+package installer
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testArchive makes an archive of the files, signed if there is a key.
+func testArchive(t *testing.T, files map[string]string, key ed25519.PrivateKey) *zip.Reader {
+	buf := new(bytes.Buffer)
+	p := newPayload(buf, 0)
+	for name, body := range files {
+		err := p.add(name, []byte(body), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := p.close(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipRdr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zipRdr
+}
+
+func TestManifestSignature(t *testing.T) {
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	files := map[string]string{"a": "hello", "dir/b": "world"}
+
+	tests := []struct {
+		desc    string
+		signKey ed25519.PrivateKey
+		key     ed25519.PublicKey
+		ok      bool
+	}{
+		{"unsigned", nil, nil, true},
+		{"signed, not verified", priv, nil, true},
+		{"signed and verified", priv, pub, true},
+		{"bad signature", priv, otherPub, false},
+		{"not signed", nil, pub, false},
+	}
+
+	for _, test := range tests {
+		zipRdr := testArchive(t, files, test.signKey)
+		read := func(name string) ([]byte, error) {
+			return readZipFile(zipRdr, name)
+		}
+		manifest, err := readManifest(read, test.key)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: manifest should be rejected", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: manifest should be accepted: %v", test.desc, err)
+			continue
+		}
+		for name, body := range files {
+			entry, ok := manifest.find(name)
+			if !ok || entry.Size != int64(len(body)) {
+				t.Errorf("%s: %s is not in the manifest: %v", test.desc, name, manifest)
+			}
+		}
+	}
+
+}
+
+func TestManifestTampered(t *testing.T) {
+
+	defer tempTmpdir(t)()
+
+	zipRdr := testArchive(t, map[string]string{"a": "hello"}, nil)
+	read := func(name string) ([]byte, error) {
+		return readZipFile(zipRdr, name)
+	}
+	manifest, err := readManifest(read, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same name and size, different content.
+	inst := Installer{}
+	inst.payload = []payloadFile{testPayloadFile("a", "jello")}
+	inst.manifest = &manifest
+	err = checkPayload(inst.payload, inst.manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = inst.readPayloadFile("a")
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Error("Tampered file should not be read:", err)
+	}
+	err = inst.extractFiles(nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Error("Tampered file should not be extracted:", err)
+	}
+
+}
+
+func TestReadKeys(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	privFile := filepath.Join(dir, "key.pem")
+	pubFile := filepath.Join(dir, "key.pub")
+	ioutil.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600)
+	ioutil.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644)
+
+	gotPriv, err := readPrivateKey(privFile)
+	if err != nil || !gotPriv.Equal(priv) {
+		t.Error("Cannot read private key:", err)
+	}
+	gotPub, err := readPublicKey(pubFile)
+	if err != nil || !gotPub.Equal(pub) {
+		t.Error("Cannot read public key:", err)
+	}
+
+	// The wrong kind of key.
+	_, err = readPublicKey(privFile)
+	if err == nil {
+		t.Error("Private key should not be read as a public key")
+	}
+	_, err = readPrivateKey(filepath.Join(dir, "missing.pem"))
+	if err == nil {
+		t.Error("Missing key file should be an error")
+	}
+
+}
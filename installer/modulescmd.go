@@ -0,0 +1,147 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// ModulesCmd runs the "modules" subcommand: it lists the registered
+// modules, or prints their JSON schemas or documentation.
+func (inst *Installer) ModulesCmd() error {
+
+	names := inst.ModulesArgs
+	if len(names) == 0 {
+		names = genesis.ModuleNames()
+	}
+	infos := []genesis.ModuleInfo{}
+	for _, name := range names {
+		info, ok := genesis.DescribeModule(name)
+		if !ok {
+			return fmt.Errorf("unknown module %q", name)
+		}
+		infos = append(infos, info)
+	}
+
+	switch {
+	case inst.Schema:
+		return printJSON(definitionSchema())
+	case inst.Markdown:
+		printModulesMarkdown(infos)
+		return nil
+	case len(inst.ModulesArgs) == 0:
+		printModules(infos)
+		return nil
+	}
+
+	schemas := make(map[string]interface{})
+	for _, info := range infos {
+		schemas[info.Key], _ = genesis.ModuleSchema(info.Name)
+	}
+	if len(infos) == 1 {
+		return printJSON(schemas[infos[0].Key])
+	}
+	return printJSON(schemas)
+
+}
+
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// printModules lists the modules, with the names used in definitions.
+func printModules(infos []genesis.ModuleInfo) {
+	for _, info := range infos {
+		fmt.Printf("    %-14s %s\n", info.Key, info.Description)
+	}
+}
+
+// printModulesMarkdown documents the modules and their fields.
+func printModulesMarkdown(infos []genesis.ModuleInfo) {
+	fmt.Println("# Modules")
+	for _, info := range infos {
+		fmt.Println("")
+		fmt.Printf("## %s (`%s`)\n", info.Name, info.Key)
+		fmt.Println("")
+		if len(info.Description) > 0 {
+			fmt.Println(info.Description)
+			fmt.Println("")
+		}
+		fmt.Println("| Field | Type | Description |")
+		fmt.Println("|-------|------|-------------|")
+		for _, field := range info.Fields {
+			desc := strings.Replace(field.Description, "|", `\|`, -1)
+			fmt.Printf("| `%s` | %s | %s |\n", field.Key, field.Type, desc)
+		}
+	}
+}
+
+// definitionSchema is a JSON schema for installer definition files, for
+// editors to complete and check them.
+func definitionSchema() map[string]interface{} {
+
+	ref := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	object := func(properties map[string]interface{}, required ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+	str := map[string]interface{}{"type": "string"}
+	tags := map[string]interface{}{"anyOf": []interface{}{
+		str, map[string]interface{}{"type": "array", "items": str},
+	}}
+
+	definitions := map[string]interface{}{
+		"tasks": map[string]interface{}{"type": "array", "items": ref("task")},
+		"condition": map[string]interface{}{"oneOf": []interface{}{
+			object(map[string]interface{}{"fact": str, "equals": map[string]interface{}{}}, "fact", "equals"),
+			object(map[string]interface{}{"file_exists": str}, "file_exists"),
+			object(map[string]interface{}{"command_succeeds": map[string]interface{}{"anyOf": []interface{}{
+				str, map[string]interface{}{"type": "array", "items": str},
+			}}}, "command_succeeds"),
+		}},
+	}
+	tasks := []interface{}{
+		object(map[string]interface{}{"section": str, "tasks": ref("tasks"), "tags": tags}, "section", "tasks"),
+		object(map[string]interface{}{"if": ref("task"), "then": ref("task")}, "if", "then"),
+		object(map[string]interface{}{
+			"switch": str,
+			"cases": map[string]interface{}{"type": "array", "items": object(map[string]interface{}{
+				"when": ref("condition"), "tasks": ref("tasks"),
+			}, "when", "tasks")},
+			"else": ref("tasks"),
+		}, "switch", "cases"),
+		object(map[string]interface{}{"when": ref("condition"), "tasks": ref("tasks")}, "when", "tasks"),
+		object(map[string]interface{}{"unless": ref("condition"), "tasks": ref("tasks")}, "unless", "tasks"),
+	}
+	for _, name := range genesis.ModuleNames() {
+		info, _ := genesis.DescribeModule(name)
+		schema, _ := genesis.ModuleSchema(name)
+		delete(schema, "$schema")
+		definitions["module."+info.Key] = schema
+		tasks = append(tasks, object(map[string]interface{}{info.Key: ref("module." + info.Key), "tags": tags}, info.Key))
+	}
+	definitions["task"] = map[string]interface{}{"anyOf": tasks}
+
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "Genesis installer definition",
+		"type":        "object",
+		"properties":  map[string]interface{}{"tasks": ref("tasks")},
+		"required":    []string{"tasks"},
+		"definitions": definitions,
+	}
+
+}
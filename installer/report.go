@@ -55,6 +55,11 @@ func ReportUnknown(msg string, err error) {
 	}
 }
 
+// ReportSkip reports a task which was not run.  It is not counted.
+func ReportSkip(msg string) {
+	fmt.Println("    \033[2m[SKIP]\033[0m", msg)
+}
+
 func PrintHeader(tag, desc string) {
 	fmt.Println("")
 	id := "\033[36m" + genesis.StringHash(tag) + "\033[0m"
@@ -7,7 +7,9 @@ import (
 // Section is a type of genesis.Doer.  It groups Doers together
 // with a label.  It is useful for two reasons: 1) it allows for
 // pretty labels in the output, and 2) it can group tasks together
-// into a Doer that can be used as part of other Doers.
+// into a Doer that can be used as part of other Doers.  A section
+// can be selected with -tags by its name, or its path (e.g.
+// "network/dns").
 type Section struct {
 	Tasks []genesis.Doer
 	Name  string
@@ -46,6 +48,18 @@ func (section Section) ID() string {
 	return id
 }
 
+func (section Section) Children(all bool) []genesis.Doer {
+	return section.Tasks
+}
+
+func (section Section) Selector() (string, []string, bool) {
+	return section.Name, nil, true
+}
+
+func (section Section) skip() string {
+	return skipTagged(section.ID(), section.Name, nil)
+}
+
 func (section *Section) AddTask(module genesis.Module) {
 	section.Tasks = append(section.Tasks, Task{module})
 }
@@ -55,7 +69,7 @@ func (section *Section) Add(doer genesis.Doer) {
 }
 
 func (section Section) Status() (genesis.Status, error) {
-	skip := SkipID(section.ID())
+	skip := section.skip()
 	if skip == "skip" {
 		return genesis.StatusUnknown, nil
 	}
@@ -65,6 +79,8 @@ func (section Section) Status() (genesis.Status, error) {
 	}
 	PrintSectionHeader(section.Name)
 	defer PrintSectionFooter(section.Name)
+	enterSection(section.Name)
+	defer leaveSection(section.Name)
 	status := genesis.StatusPass
 	for _, task := range section.Tasks {
 		s, _ := task.Status()
@@ -79,7 +95,7 @@ func (section Section) Status() (genesis.Status, error) {
 }
 
 func (section Section) Do() (bool, error) {
-	skip := SkipID(section.ID())
+	skip := section.skip()
 	if skip == "skip" {
 		return false, nil
 	}
@@ -89,6 +105,8 @@ func (section Section) Do() (bool, error) {
 	}
 	PrintSectionHeader(section.Name)
 	defer PrintSectionFooter(section.Name)
+	enterSection(section.Name)
+	defer leaveSection(section.Name)
 	for _, task := range section.Tasks {
 		changed, err := task.Do()
 		if err != nil {
@@ -99,7 +117,7 @@ func (section Section) Do() (bool, error) {
 }
 
 func (section Section) Undo() (bool, error) {
-	skip := SkipID(section.ID())
+	skip := section.skip()
 	if skip == "skip" {
 		return false, nil
 	}
@@ -109,6 +127,8 @@ func (section Section) Undo() (bool, error) {
 	}
 	PrintSectionHeader(section.Name)
 	defer PrintSectionFooter(section.Name)
+	enterSection(section.Name)
+	defer leaveSection(section.Name)
 	for k := len(section.Tasks) - 1; k >= 0; k-- {
 		task := section.Tasks[k]
 		changed, err := task.Undo()
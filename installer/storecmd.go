@@ -0,0 +1,228 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
+)
+
+// StoreCmd runs the "store" subcommand, for inspecting and
+// cleaning up the backup store.
+func (inst *Installer) StoreCmd() error {
+
+	defer os.RemoveAll(genesis.Tmpdir)
+
+	entries, err := genesis.Store.Entries()
+	if err != nil {
+		return err
+	}
+
+	cmd, args := inst.StoreArgs[0], inst.StoreArgs[1:]
+	switch cmd {
+	case "list":
+		for _, entry := range entries {
+			printEntry(entry)
+		}
+		fmt.Println("")
+		fmt.Printf("    %d entries in %s\n", len(entries), storeLocation())
+	case "show":
+		for _, entry := range matchEntries(entries, args) {
+			printEntry(entry)
+			showEntry(entry)
+		}
+	case "diff":
+		if len(args) == 0 {
+			return errors.New("store diff needs a file path")
+		}
+		for _, entry := range matchEntries(entries, args[:1]) {
+			printEntry(entry)
+			err = diffEntry(entry, args[1:])
+			if err != nil {
+				fmt.Println("   ", err)
+			}
+		}
+	case "gc":
+		return inst.storeGC(entries)
+	default:
+		return fmt.Errorf("unknown store command: %s", cmd)
+	}
+	return nil
+
+}
+
+// storeLocation describes where the store is kept: the archive file,
+// the directory, or "memory".
+func storeLocation() string {
+	switch backend := genesis.Store.Backend.(type) {
+	case *store.ArchiveBackend:
+		return backend.File
+	case store.DirBackend:
+		return backend.Dir
+	}
+	return "memory"
+}
+
+// matchEntries picks out the entries for the given file paths
+// (or all entries if no paths are given).
+func matchEntries(entries []store.Entry, paths []string) []store.Entry {
+	if len(paths) == 0 {
+		return entries
+	}
+	matched := []store.Entry{}
+	for _, entry := range entries {
+		for _, path := range paths {
+			if entry.Path == genesis.ExpandHome(path) {
+				matched = append(matched, entry)
+			}
+		}
+	}
+	return matched
+}
+
+func printEntry(entry store.Entry) {
+	fmt.Println("")
+	fmt.Printf("    \033[36m%s\033[0m %s\n", entry.Kind, entry.Path)
+	if len(entry.Label) > 0 {
+		fmt.Println("      label:", strings.Split(entry.Label, "\n")[0])
+	}
+	for _, task := range entry.Tasks {
+		fmt.Printf("      task:  \033[36m%s\033[0m %s\n", task.Tag, task.Desc)
+	}
+}
+
+func showEntry(entry store.Entry) {
+	if entry.Kind == "patch" {
+		patch, _ := genesis.Store.ReadPatch(entry.Path, entry.Label)
+		fmt.Println("")
+		fmt.Println(patch)
+		return
+	}
+	gens, _ := genesis.Store.Generations(entry.Path, entry.Label)
+	for _, gen := range gens {
+		desc := fmt.Sprintf("mode=%v uid=%d gid=%d mtime=%s", gen.Mode, gen.Uid, gen.Gid, gen.ModTime.Format("2006-01-02 15:04:05"))
+		if gen.Missing {
+			desc = "file did not exist"
+		} else if len(gen.Link) > 0 {
+			desc = "symlink to " + gen.Link
+		}
+		fmt.Printf("      %3d  %s  run=%s  %s\n", gen.N, gen.Time.Format("2006-01-02 15:04:05"), gen.RunID, desc)
+	}
+}
+
+// diffEntry shows what restoring an entry would do to the live file.
+func diffEntry(entry store.Entry, args []string) error {
+	live, _ := ioutil.ReadFile(entry.Path)
+	if entry.Kind == "patch" {
+		restored, conflicts, err := genesis.Store.Unpatch(entry.Path, entry.Label, string(live))
+		if err != nil {
+			return err
+		}
+		fmt.Println(store.Diff(string(live), restored))
+		if conflicts > 0 {
+			fmt.Printf("\n    %d conflict(s) with later edits; remove would refuse.\n", conflicts)
+		}
+		return nil
+	}
+	gens, err := genesis.Store.Generations(entry.Path, entry.Label)
+	if err != nil || len(gens) == 0 {
+		return errors.New("no backups")
+	}
+	n := 1
+	if len(args) > 0 {
+		n, err = strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(gens) {
+			return fmt.Errorf("no such generation: %s", args[0])
+		}
+	}
+	backup, _ := genesis.Store.ReadGeneration(entry.Path, entry.Label, n)
+	fmt.Println(store.Diff(string(live), string(backup)))
+	return nil
+}
+
+// storeGC removes entries whose tasks are no longer in the installer.
+// File backups are kept while any task still writes to the file, since
+// a changed task has a new hash but the original file is still needed.
+func (inst *Installer) storeGC(entries []store.Entry) error {
+	tags := make(map[string]bool)
+	for _, tag := range TaskTags(inst.Tasks) {
+		tags[tag] = true
+	}
+	paths := taskTargets(inst.Tasks)
+	removed := 0
+	for _, entry := range entries {
+		keep := len(entry.Tasks) == 0 || (entry.Kind == "file" && paths[entry.Path])
+		for _, task := range entry.Tasks {
+			if tags[task.Tag] {
+				keep = true
+			}
+		}
+		if keep {
+			continue
+		}
+		printEntry(entry)
+		removed++
+		if inst.DryRun {
+			continue
+		}
+		err := genesis.Store.RemoveEntry(entry)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("")
+	if inst.DryRun {
+		fmt.Printf("    Would remove %d of %d entries.\n", removed, len(entries))
+	} else {
+		fmt.Printf("    Removed %d of %d entries.\n", removed, len(entries))
+	}
+	return nil
+}
+
+// TaskTags lists the hash tags of all Tasks within a list of Doers.
+func TaskTags(doers []genesis.Doer) []string {
+	tags := []string{}
+	walkTasks(doers, func(doer genesis.Doer) {
+		tags = append(tags, genesis.StringHash(doer.ID()))
+	})
+	return tags
+}
+
+// taskTargets lists the files which the Tasks within a list of Doers
+// write to (see genesis.Targeter).
+func taskTargets(doers []genesis.Doer) map[string]bool {
+	paths := make(map[string]bool)
+	walkTasks(doers, func(doer genesis.Doer) {
+		task, ok := doer.(Task)
+		if !ok {
+			return
+		}
+		targeter, ok := task.Module.(genesis.Targeter)
+		if !ok {
+			return
+		}
+		for _, target := range targeter.Targets() {
+			if len(target) > 0 {
+				paths[genesis.ExpandHome(target)] = true
+			}
+		}
+	})
+	return paths
+}
+
+// walkTasks calls fn for every Task (or other Doer which is not a
+// group) within a list of Doers, including those which will not run.
+func walkTasks(doers []genesis.Doer, fn func(genesis.Doer)) {
+	eachDoer(doers, true, func(doer genesis.Doer, children []genesis.Doer, skip string) {
+		if children == nil {
+			fn(doer)
+			return
+		}
+		walkTasks(children, fn)
+	})
+}
@@ -0,0 +1,35 @@
+package installer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+// targetModule is a module which writes to a file.
+type targetModule struct {
+	testModule
+	Target string
+}
+
+func (m targetModule) Targets() []string { return []string{m.Target} }
+
+func TestTaskTargets(t *testing.T) {
+
+	section := NewSection("section")
+	section.Add(Task{targetModule{testModule{Name: "b"}, "/etc/b"}})
+	doers := []genesis.Doer{
+		Task{targetModule{testModule{Name: "a", File: "/tmp/input"}, "/etc/a"}},
+		Task{testModule{Name: "c", File: "/etc/c"}},
+		Task{targetModule{testModule{Name: "d"}, ""}},
+		section,
+	}
+
+	targets := taskTargets(doers)
+	want := map[string]bool{"/etc/a": true, "/etc/b": true}
+	if !reflect.DeepEqual(targets, want) {
+		t.Error("Wrong targets:", targets)
+	}
+
+}
@@ -37,6 +37,20 @@ func (sw Switch) ID() string {
 	return id
 }
 
+// Children lists the Doers which run, or (with all) every case.
+func (sw Switch) Children(all bool) []genesis.Doer {
+	if all {
+		return append(append([]genesis.Doer{}, sw.Dos...), sw.Donts...)
+	}
+	return sw.Dos
+}
+
+// Selector reports that a Switch is not selected itself, since it does
+// not check -tags and -skip-tags (only the Doers within it do).
+func (sw Switch) Selector() (string, []string, bool) {
+	return "", nil, false
+}
+
 func (sw *Switch) Case(condition bool, doer genesis.Doer) {
 	if condition {
 		sw.Dos = append(sw.Dos, doer)
@@ -70,21 +84,25 @@ func (sw Switch) Status() (genesis.Status, error) {
 }
 
 func (sw Switch) Do() (bool, error) {
+	changed := false
 	for _, task := range sw.Dos {
-		changed, err := task.Do()
+		c, err := task.Do()
+		changed = changed || c
 		if err != nil {
 			return changed, err
 		}
 	}
-	return true, nil
+	return changed, nil
 }
 
 func (sw Switch) Undo() (bool, error) {
+	changed := false
 	for _, task := range sw.Dos {
-		changed, err := task.Undo()
+		c, err := task.Undo()
+		changed = changed || c
 		if err != nil {
 			return changed, err
 		}
 	}
-	return true, nil
+	return changed, nil
 }
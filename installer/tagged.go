@@ -0,0 +1,67 @@
+package installer
+
+import (
+	"github.com/wx13/genesis"
+)
+
+// Tagged is a type of genesis.Doer.  It gives a Doer user-assigned tags,
+// so that it can be selected with -tags and -skip-tags by a name which
+// does not change when the Doer does (unlike its hash tag).  Tags may be
+// matched with glob patterns, e.g. "net-*".
+type Tagged struct {
+	genesis.Doer
+	Tags []string
+}
+
+// Tag gives a Doer (e.g. a Task or a Section) some tags.
+func Tag(doer genesis.Doer, tags ...string) Tagged {
+	return Tagged{Doer: doer, Tags: tags}
+}
+
+func (tagged Tagged) Children(all bool) []genesis.Doer {
+	return []genesis.Doer{tagged.Doer}
+}
+
+func (tagged Tagged) Selector() (string, []string, bool) {
+	return "", tagged.Tags, true
+}
+
+func (tagged Tagged) skip() string {
+	return skipTagged(tagged.ID(), "", tagged.Tags)
+}
+
+func (tagged Tagged) Status() (genesis.Status, error) {
+	skip := tagged.skip()
+	if skip == "skip" {
+		return genesis.StatusUnknown, nil
+	}
+	if skip == "do" {
+		doTags := EmptyDoTags()
+		defer RestoreDoTags(doTags)
+	}
+	return tagged.Doer.Status()
+}
+
+func (tagged Tagged) Do() (bool, error) {
+	skip := tagged.skip()
+	if skip == "skip" {
+		return false, nil
+	}
+	if skip == "do" {
+		doTags := EmptyDoTags()
+		defer RestoreDoTags(doTags)
+	}
+	return tagged.Doer.Do()
+}
+
+func (tagged Tagged) Undo() (bool, error) {
+	skip := tagged.skip()
+	if skip == "skip" {
+		return false, nil
+	}
+	if skip == "do" {
+		doTags := EmptyDoTags()
+		defer RestoreDoTags(doTags)
+	}
+	return tagged.Doer.Undo()
+}
@@ -0,0 +1,55 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// target is a platform to compile an installer for, written as
+// GOOS/GOARCH, with an optional GOARM (e.g. "linux/arm/7").
+type target struct {
+	goos   string
+	goarch string
+	goarm  string
+}
+
+func parseTarget(spec string) (target, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) < 2 || len(parts) > 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return target{}, fmt.Errorf("bad target %q; use GOOS/GOARCH or GOOS/arm/GOARM", spec)
+	}
+	t := target{goos: parts[0], goarch: parts[1]}
+	if len(parts) == 3 {
+		if t.goarch != "arm" {
+			return target{}, fmt.Errorf("bad target %q; only arm has a version", spec)
+		}
+		t.goarm = parts[2]
+	}
+	return t, nil
+}
+
+// suffix names executables for the target, e.g. "linux-armv7".
+func (t target) suffix() string {
+	s := t.goos + "-" + t.goarch
+	if len(t.goarm) > 0 {
+		s += "v" + t.goarm
+	}
+	if t.goos == "windows" {
+		s += ".exe"
+	}
+	return s
+}
+
+// goBuild compiles a package for the target.
+func (t target) goBuild(pkg, output string) error {
+	cmd := exec.Command("go", "build", "-o", output, pkg)
+	cmd.Env = append(os.Environ(), "GOOS="+t.goos, "GOARCH="+t.goarch, "CGO_ENABLED=0")
+	if len(t.goarm) > 0 {
+		cmd.Env = append(cmd.Env, "GOARM="+t.goarm)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
 )
 
 // Task is the most fundamental Doer. It consists of just a single module.
@@ -62,6 +63,7 @@ func (task Task) Do() (bool, error) {
 	}
 
 	// Otherwise, run the installer.
+	setStoreTask(id)
 	msg, err = task.Install()
 	if err != nil {
 		ReportFail(msg, err)
@@ -102,3 +104,14 @@ func (task Task) Undo() (bool, error) {
 	ReportPass(msg, err)
 	return true, nil
 }
+
+// setStoreTask lets the store know which task is making changes.
+func setStoreTask(id string) {
+	if genesis.Store == nil {
+		return
+	}
+	genesis.Store.Task = store.TaskRef{
+		Tag:  genesis.StringHash(id),
+		Desc: strings.Split(id, "\n")[0],
+	}
+}
@@ -0,0 +1,134 @@
+package installer
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// Condition is checked at the moment a Conditional runs.
+type Condition func() bool
+
+// Conditional is a type of genesis.Doer.  It runs a Doer only if a
+// condition holds.  Unlike Switch, whose conditions are fixed when the
+// installer is put together, the condition is checked when the Doer
+// runs, so it can depend on earlier tasks.
+type Conditional struct {
+	Condition Condition
+	Doer      genesis.Doer
+	Negate    bool   // run the Doer if the condition does not hold
+	Name      string // optional; used for the ID
+}
+
+// When runs a Doer only if the condition holds.
+func When(condition Condition, doer genesis.Doer) *Conditional {
+	return &Conditional{Condition: condition, Doer: doer}
+}
+
+// Unless runs a Doer only if the condition does not hold.
+func Unless(condition Condition, doer genesis.Doer) *Conditional {
+	return &Conditional{Condition: condition, Doer: doer, Negate: true}
+}
+
+func (cond Conditional) ID() string {
+	if cond.Name != "" {
+		return cond.Name
+	}
+	if cond.Negate {
+		return "unless " + cond.Doer.ID()
+	}
+	return "when " + cond.Doer.ID()
+}
+
+func (cond Conditional) Files() []string {
+	return cond.Doer.Files()
+}
+
+func (cond Conditional) Children(all bool) []genesis.Doer {
+	return []genesis.Doer{cond.Doer}
+}
+
+func (cond Conditional) Selector() (string, []string, bool) {
+	return "", nil, true
+}
+
+// holds checks the condition, and reports if the Doer will be skipped.
+func (cond Conditional) holds() bool {
+	if cond.Condition() != cond.Negate {
+		return true
+	}
+	id := cond.Doer.ID()
+	PrintHeader(id, strings.Split(id, "\n")[0])
+	ReportSkip("condition not met")
+	return false
+}
+
+func (cond Conditional) Status() (genesis.Status, error) {
+	skip := SkipID(cond.ID())
+	if skip == "skip" {
+		return genesis.StatusUnknown, nil
+	}
+	if skip == "do" {
+		doTags := EmptyDoTags()
+		defer RestoreDoTags(doTags)
+	}
+	if !cond.holds() {
+		return genesis.StatusUnknown, nil
+	}
+	return cond.Doer.Status()
+}
+
+func (cond Conditional) Do() (bool, error) {
+	skip := SkipID(cond.ID())
+	if skip == "skip" {
+		return false, nil
+	}
+	if skip == "do" {
+		doTags := EmptyDoTags()
+		defer RestoreDoTags(doTags)
+	}
+	if !cond.holds() {
+		return false, nil
+	}
+	return cond.Doer.Do()
+}
+
+func (cond Conditional) Undo() (bool, error) {
+	skip := SkipID(cond.ID())
+	if skip == "skip" {
+		return false, nil
+	}
+	if skip == "do" {
+		doTags := EmptyDoTags()
+		defer RestoreDoTags(doTags)
+	}
+	if !cond.holds() {
+		return false, nil
+	}
+	return cond.Doer.Undo()
+}
+
+// FileExists checks if a file (or directory) exists.
+func FileExists(path string) Condition {
+	return func() bool {
+		_, err := os.Stat(genesis.ExpandHome(path))
+		return err == nil
+	}
+}
+
+// CommandSucceeds checks if a command runs without error.
+func CommandSucceeds(name string, args ...string) Condition {
+	return func() bool {
+		return exec.Command(name, args...).Run() == nil
+	}
+}
+
+// FactEquals checks a fact (e.g. "DistroID", or a custom fact).
+func (inst *Installer) FactEquals(name, value string) Condition {
+	return func() bool {
+		fact, ok := inst.Facts.Fact(name)
+		return ok && fact == value
+	}
+}
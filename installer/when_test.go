@@ -0,0 +1,48 @@
+package installer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func TestConditional(t *testing.T) {
+
+	setTags(nil, nil)
+	exists := FileExists(os.TempDir())
+	missing := FileExists("/no/such/file")
+	pass := Task{testModule{Name: "pass", Pass: true}}
+	fail := Task{testModule{Name: "fail"}}
+
+	tests := []struct {
+		name   string
+		cond   *Conditional
+		status genesis.Status
+	}{
+		{"when (holds)", When(exists, pass), genesis.StatusPass},
+		{"when (holds, failing)", When(exists, fail), genesis.StatusFail},
+		{"when (does not hold)", When(missing, pass), genesis.StatusUnknown},
+		{"unless (holds)", Unless(exists, pass), genesis.StatusUnknown},
+		{"unless (does not hold)", Unless(missing, fail), genesis.StatusFail},
+	}
+	for _, test := range tests {
+		status, _ := test.cond.Status()
+		if status != test.status {
+			t.Errorf("%s: status should be %v, not %v", test.name, test.status, status)
+		}
+	}
+
+	// The Doer only runs if the condition holds.
+	installed := 0
+	task := Task{testModule{Name: "count", Installed: &installed}}
+	When(missing, task).Do()
+	if installed != 0 {
+		t.Error("Doer should not run when the condition does not hold.")
+	}
+	changed, err := When(exists, task).Do()
+	if !changed || err != nil || installed != 1 {
+		t.Error("Doer should run when the condition holds:", changed, err, installed)
+	}
+
+}
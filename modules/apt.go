@@ -13,6 +13,16 @@ type Apt struct {
 	Absent bool
 }
 
+func init() {
+	genesis.RegisterModule("Apt", Apt{}, genesis.ModuleDoc{
+		Description: "Installs (or removes) a debian package with apt-get.",
+		Fields: map[string]string{
+			"Name":   "Name of the package.",
+			"Absent": "Ensure the package is not installed.",
+		},
+	})
+}
+
 func (apt Apt) ID() string {
 	if apt.Absent {
 		return "Apt remove " + apt.Name
@@ -17,6 +17,19 @@ type Command struct {
 	Timeout      time.Duration
 }
 
+func init() {
+	genesis.RegisterModule("Command", Command{}, genesis.ModuleDoc{
+		Description: "Runs a command.  With PSPattern, the command is only run if no process matches the pattern (e.g. to start a daemon).",
+		Fields: map[string]string{
+			"Cmd":          "The command to run.",
+			"Opts":         "Arguments to the command.",
+			"PSPattern":    "Process pattern; the status passes if a matching process is running.",
+			"IgnoreErrors": "Report success even if the command fails.",
+			"Timeout":      "Stop the command after this long, e.g. \"30s\".",
+		},
+	})
+}
+
 func MakeCommand(cmd string, opts ...string) Command {
 	return Command{Cmd: cmd, Opts: opts}
 }
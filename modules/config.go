@@ -0,0 +1,87 @@
+package modules
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// The structured config modules (Ini, KeyValue, JSONFile, YAMLFile)
+// share the same install/remove mechanics as LineInFile: the file is
+// rewritten in place, and a reverse patch is saved to the store.
+
+// readConfig reads a config file.  A missing file is treated as empty.
+func readConfig(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(b), err
+}
+
+// writeConfig saves the reverse patch to the store, and then writes
+// the new content, keeping the file permissions if it already exists.
+// A new file (mode 0644) is recorded in the store as missing, so that
+// Remove can delete it.
+func writeConfig(file, orig, content, label string) error {
+	err := genesis.Store.SavePatch(file, orig, content, label)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	info, err := os.Stat(file)
+	if err == nil {
+		mode = info.Mode()
+	} else if os.IsNotExist(err) {
+		err = genesis.Store.SaveFile(file, label)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(file, []byte(content), mode)
+}
+
+// removeConfig reverses the changes made by writeConfig, and removes the
+// file if writeConfig created it.
+func removeConfig(file, label string) (string, error) {
+	err := genesis.Store.ApplyPatch(file, label)
+	if err != nil {
+		return "Could not apply patch.", err
+	}
+	return "Patch applied", removeCreatedFile(file, label)
+}
+
+// splitPointer splits a JSON pointer (RFC 6901), such as "/a/b/0",
+// into its unescaped components.
+func splitPointer(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if len(path) == 0 {
+		return []string{}
+	}
+	keys := strings.Split(path, "/")
+	for k, key := range keys {
+		key = strings.Replace(key, "~1", "/", -1)
+		keys[k] = strings.Replace(key, "~0", "~", -1)
+	}
+	return keys
+}
+
+// elementPath handles a path ending in "-", which stands for an element
+// of an array with the given value, rather than for an index.  Such an
+// element is appended if the array has no equal element, and all equal
+// elements are removed if Absent is set.  elementPath returns the path
+// to the array, and whether the path ends in "-".
+func elementPath(keys []string) ([]string, bool, error) {
+	for k, key := range keys {
+		if key == "-" && k < len(keys)-1 {
+			return nil, false, errors.New(`"-" must be the last component of the path`)
+		}
+	}
+	if len(keys) > 0 && keys[len(keys)-1] == "-" {
+		return keys[:len(keys)-1], true, nil
+	}
+	return keys, false, nil
+}
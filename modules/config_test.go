@@ -0,0 +1,271 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
+)
+
+// checkConfig writes content to the module's file, and runs the module
+// through install, status and remove.  It returns the installed content.
+func checkConfig(t *testing.T, module genesis.Module, filename, content string) string {
+
+	genesis.Store = store.NewMemory()
+	defer func() { genesis.Store = nil }()
+	ioutil.WriteFile(filename, []byte(content), 0600)
+
+	status, msg, _ := module.Status()
+	if status != genesis.StatusFail {
+		t.Error("Status should fail before install:", msg)
+	}
+	msg, err := module.Install()
+	if err != nil {
+		t.Error("Install failed:", msg, err)
+	}
+	status, msg, _ = module.Status()
+	if status != genesis.StatusPass {
+		t.Error("Status should pass after install:", msg)
+	}
+	data, _ := ioutil.ReadFile(filename)
+	info, _ := os.Stat(filename)
+	if info.Mode().Perm() != 0600 {
+		t.Error("File mode was not preserved:", info.Mode())
+	}
+
+	msg, err = module.Remove()
+	if err != nil {
+		t.Error("Remove failed:", msg, err)
+	}
+	orig, _ := ioutil.ReadFile(filename)
+	if string(orig) != content {
+		t.Errorf("Remove did not restore the file: %q", orig)
+	}
+
+	return string(data)
+}
+
+func TestKeyValue(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "default")
+
+	content := "# Defaults\nexport OPTS=\"-a -b\" # comment\nENABLED=no\n"
+	data := checkConfig(t, KeyValue{File: filename, Key: "OPTS", Value: "-a -c"}, filename, content)
+	if data != "# Defaults\nexport OPTS=\"-a -c\" # comment\nENABLED=no\n" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+
+	data = checkConfig(t, KeyValue{File: filename, Key: "NEW", Value: "1"}, filename, content)
+	if !strings.HasSuffix(data, "ENABLED=no\nNEW=1\n") {
+		t.Errorf("Key should be appended: %q", data)
+	}
+
+	data = checkConfig(t, KeyValue{File: filename, Key: "ENABLED", Absent: true}, filename, content)
+	if strings.Contains(data, "ENABLED") {
+		t.Errorf("Key should be removed: %q", data)
+	}
+
+	data = checkConfig(t, KeyValue{File: filename, Key: "ENABLED", Value: "yes"}, filename, "ENABLED=no  # off\r\nX=1")
+	if data != "ENABLED=yes  # off\r\nX=1" {
+		t.Errorf("Comment and line endings should be kept: %q", data)
+	}
+
+	if parseShellValue(`'a b' # x`) != "a b" || parseShellValue(`"a \"b\""`) != `a "b"` || parseShellValue("a # x") != "a" {
+		t.Error("Could not parse quoted shell values.")
+	}
+
+}
+
+func TestIni(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.ini")
+
+	content := "; global\nname=x\n\n[server]\nport = 80\n\n[client]\nretry: 3\n"
+	data := checkConfig(t, Ini{File: filename, Section: "server", Key: "port", Value: "8080"}, filename, content)
+	if data != "; global\nname=x\n\n[server]\nport = 8080\n\n[client]\nretry: 3\n" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+
+	data = checkConfig(t, Ini{File: filename, Section: "server", Key: "host", Value: "a"}, filename, content)
+	if !strings.Contains(data, "port = 80\nhost = a\n\n[client]") {
+		t.Errorf("Key should be added to end of section: %q", data)
+	}
+
+	data = checkConfig(t, Ini{File: filename, Section: "new", Key: "k", Value: "v"}, filename, content)
+	if !strings.HasSuffix(data, "retry: 3\n\n[new]\nk = v\n") {
+		t.Errorf("Section should be added: %q", data)
+	}
+
+	data = checkConfig(t, Ini{File: filename, Key: "name", Absent: true}, filename, content)
+	if strings.Contains(data, "name") {
+		t.Errorf("Global key should be removed: %q", data)
+	}
+
+}
+
+func TestJSONFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "daemon.json")
+
+	content := "{\n    \"b\": 1,\n    \"a\": {\n        \"x\": \"<y>\"\n    }\n}\n"
+	data := checkConfig(t, JSONFile{File: filename, Path: "/a/x", Value: "z"}, filename, content)
+	if data != "{\n    \"b\": 1,\n    \"a\": {\n        \"x\": \"z\"\n    }\n}\n" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+
+	data = checkConfig(t, JSONFile{File: filename, Path: "/c/d", Value: []int{1, 2}}, filename, content)
+	if !strings.Contains(data, "\"x\": \"<y>\"") || !strings.Contains(data, "\"c\": {\n        \"d\": [") {
+		t.Errorf("Value should be added: %q", data)
+	}
+
+	data = checkConfig(t, JSONFile{File: filename, Path: "/b", Absent: true}, filename, content)
+	if strings.Contains(data, "\"b\"") {
+		t.Errorf("Value should be removed: %q", data)
+	}
+
+	data = checkConfig(t, JSONFile{File: filename, Path: "/a/x", Value: "z"}, filename, `{"b":1,"a":{"x":"y"}}`)
+	if data != `{"b":1,"a":{"x":"z"}}` {
+		t.Errorf("Compact layout should be kept: %q", data)
+	}
+
+	data = checkConfig(t, JSONFile{File: filename, Path: "/dns/-", Value: "8.8.8.8"}, filename, `{"dns":["1.1.1.1"]}`)
+	if data != `{"dns":["1.1.1.1","8.8.8.8"]}` {
+		t.Errorf("Element should be appended once: %q", data)
+	}
+
+	data = checkConfig(t, JSONFile{File: filename, Path: "/dns/-", Value: "8.8.8.8"}, filename, `{}`)
+	if data != `{"dns":["8.8.8.8"]}` {
+		t.Errorf("Array should be created: %q", data)
+	}
+
+	data = checkConfig(t, JSONFile{File: filename, Path: "/dns/-", Value: "8.8.8.8", Absent: true}, filename, `{"dns":["8.8.8.8","1.1.1.1","8.8.8.8"]}`)
+	if data != `{"dns":["1.1.1.1"]}` {
+		t.Errorf("Elements should be removed: %q", data)
+	}
+
+	_, err = JSONFile{File: filename, Path: "/dns/-/x", Value: 1}.Install()
+	if err == nil {
+		t.Error("A \"-\" before the end of the path should be an error.")
+	}
+
+}
+
+func TestYAMLFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "app.yaml")
+
+	content := "# App config\nserver:\n  port: 80 # http\n  host: a\nlist:\n  - 1\n"
+	data := checkConfig(t, YAMLFile{File: filename, Path: "/server/port", Value: 8080}, filename, content)
+	if data != "# App config\nserver:\n  port: 8080 # http\n  host: a\nlist:\n  - 1\n" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+
+	data = checkConfig(t, YAMLFile{File: filename, Path: "/server/tls/enabled", Value: true}, filename, content)
+	if !strings.Contains(data, "  host: a\n  tls:\n    enabled: true\n") {
+		t.Errorf("Value should be added: %q", data)
+	}
+
+	data = checkConfig(t, YAMLFile{File: filename, Path: "/server/host", Absent: true}, filename, content)
+	if strings.Contains(data, "host") {
+		t.Errorf("Value should be removed: %q", data)
+	}
+
+	data = checkConfig(t, YAMLFile{File: filename, Path: "/list/-", Value: 2}, filename, content)
+	if !strings.HasSuffix(data, "list:\n  - 1\n  - 2\n") {
+		t.Errorf("Element should be appended once: %q", data)
+	}
+
+	data = checkConfig(t, YAMLFile{File: filename, Path: "/server/names/-", Value: "a"}, filename, content)
+	if !strings.Contains(data, "  names:\n    - a\n") {
+		t.Errorf("List should be created: %q", data)
+	}
+
+	data = checkConfig(t, YAMLFile{File: filename, Path: "/list/-", Value: 1, Absent: true}, filename, content)
+	if strings.Contains(data, "- 1") {
+		t.Errorf("Element should be removed: %q", data)
+	}
+
+	// Blank lines and indentation are kept.
+	content = "server:\n    port: 80\n\n    host: a\n\n\nlist:\n    - 1\n"
+	data = checkConfig(t, YAMLFile{File: filename, Path: "/server/port", Value: 8080}, filename, content)
+	if data != "server:\n    port: 8080\n\n    host: a\n\n\nlist:\n    - 1\n" {
+		t.Errorf("Formatting should be kept: %q", data)
+	}
+
+	// Later documents would be lost, so they are not supported.
+	content = "a: 1\n---\nb: 2\n"
+	ioutil.WriteFile(filename, []byte(content), 0600)
+	_, err = YAMLFile{File: filename, Path: "/a", Value: 3}.Install()
+	if err == nil {
+		t.Error("A file with several documents should be an error.")
+	}
+	orig, _ := ioutil.ReadFile(filename)
+	if string(orig) != content {
+		t.Errorf("File should not be changed: %q", orig)
+	}
+
+}
+
+func TestConfigCreate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	genesis.Store = store.NewMemory()
+	defer func() { genesis.Store = nil }()
+
+	filename := filepath.Join(dir, "new")
+	modules := []genesis.Module{
+		Ini{File: filename, Section: "server", Key: "port", Value: "80"},
+		KeyValue{File: filename, Key: "PORT", Value: "80"},
+		JSONFile{File: filename, Path: "/port", Value: 80},
+		YAMLFile{File: filename, Path: "/port", Value: 80},
+	}
+
+	for _, module := range modules {
+		if len(module.Files()) != 1 || module.Files()[0] != filename {
+			t.Errorf("%s: Files() should list the file: %v", module.ID(), module.Files())
+		}
+		msg, err := module.Install()
+		if err != nil {
+			t.Error("Install failed:", msg, err)
+		}
+		if !genesis.FileExists(filename) {
+			t.Errorf("%s: file should be created", module.ID())
+		}
+		msg, err = module.Remove()
+		if err != nil {
+			t.Error("Remove failed:", msg, err)
+		}
+		if genesis.FileExists(filename) {
+			t.Errorf("%s: created file should be removed", module.ID())
+		}
+	}
+
+}
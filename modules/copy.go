@@ -8,6 +8,7 @@ import (
 	"regexp"
 
 	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
 )
 
 type CopyFile struct {
@@ -15,6 +16,16 @@ type CopyFile struct {
 	Src  string
 }
 
+func init() {
+	genesis.RegisterModule("CopyFile", CopyFile{}, genesis.ModuleDoc{
+		Description: "Copies a file from the installer archive to Dest.",
+		Fields: map[string]string{
+			"Dest": "Where to copy the file to.",
+			"Src":  "The file to copy, relative to the archive (or starting with / or ./ for a local file).",
+		},
+	})
+}
+
 func (cpf CopyFile) src() string {
 	match, _ := regexp.MatchString("^[.]?/", cpf.Src)
 	if match {
@@ -31,6 +42,10 @@ func (cpf CopyFile) Files() []string {
 	return []string{cpf.src()}
 }
 
+func (cpf CopyFile) Targets() []string {
+	return []string{cpf.Dest}
+}
+
 func (cpf CopyFile) Remove() (string, error) {
 
 	cpf.Dest = genesis.ExpandHome(cpf.Dest)
@@ -39,6 +54,9 @@ func (cpf CopyFile) Remove() (string, error) {
 	if err == nil {
 		return "Successfully restored destination file.", nil
 	}
+	if err == store.ErrNoBackup {
+		return "No backup of destination file; leaving it in place.", nil
+	}
 	return "Failed to restore destination file.", err
 }
 
@@ -17,6 +17,18 @@ type Dpkg struct {
 	Absent bool
 }
 
+func init() {
+	genesis.RegisterModule("Dpkg", Dpkg{}, genesis.ModuleDoc{
+		Description: "Installs (or removes) a debian package file with dpkg.",
+		Fields: map[string]string{
+			"Path":   "The .deb file, relative to the archive.",
+			"Name":   "Name of the package.",
+			"Force":  "Install even if the package is already installed.",
+			"Absent": "Ensure the package is not installed.",
+		},
+	})
+}
+
 func (dpkg Dpkg) path() string {
 	if dpkg.Path == "" {
 		return ""
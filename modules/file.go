@@ -18,6 +18,19 @@ type File struct {
 	Local  bool // Don't follow links
 }
 
+func init() {
+	genesis.RegisterModule("File", File{}, genesis.ModuleDoc{
+		Description: "Sets the permissions and owner of a file, or removes it.",
+		Fields: map[string]string{
+			"Path":   "Path to the file (may be a glob pattern).",
+			"Mode":   "Permissions, e.g. 0644.",
+			"Owner":  "Owner of the file.",
+			"Absent": "Ensure the file does not exist.",
+			"Local":  "Don't follow links.",
+		},
+	})
+}
+
 func (file File) ID() string {
 	return fmt.Sprintf("File: %+v", file)
 }
@@ -26,6 +39,10 @@ func (file File) Files() []string {
 	return []string{file.Path}
 }
 
+func (file File) Targets() []string {
+	return []string{file.Path}
+}
+
 type fileStat struct {
 	path string
 	info os.FileInfo
@@ -94,12 +111,10 @@ func (file File) Install() (string, error) {
 	}
 	for _, path := range paths {
 		if len(file.Owner) > 0 {
-			user, err := user.Lookup(file.Owner)
+			uid, gid, err := lookupOwner(file.Owner)
 			if err != nil {
 				return "Cannot lookup owner.", err
 			}
-			uid, _ := strconv.Atoi(user.Uid)
-			gid, _ := strconv.Atoi(user.Gid)
 			err = os.Chown(path, uid, gid)
 			if err != nil {
 				return "Cannot change ownership.", err
@@ -112,3 +127,14 @@ func (file File) Install() (string, error) {
 	}
 	return "Successfully changed permissions.", nil
 }
+
+// lookupOwner finds the uid and gid of a user.
+func lookupOwner(owner string) (int, int, error) {
+	user, err := user.Lookup(owner)
+	if err != nil {
+		return -1, -1, err
+	}
+	uid, _ := strconv.Atoi(user.Uid)
+	gid, _ := strconv.Atoi(user.Gid)
+	return uid, gid, nil
+}
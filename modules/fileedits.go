@@ -0,0 +1,128 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// FileEdits applies an ordered list of line edits to a single file.
+// The file is read and written once, and a single patch is stored,
+// no matter how many edits there are.
+type FileEdits struct {
+	File  string
+	Edits []LineInFile // the File field of each edit is ignored
+
+	// Optional, for creating a file that does not exist
+	Create bool        // create the file if it does not exist
+	Mode   os.FileMode // permissions of created file (defaults to 0644)
+	Owner  string      // owner of created file
+}
+
+func init() {
+	genesis.RegisterModule("FileEdits", FileEdits{}, genesis.ModuleDoc{
+		Description: "Applies a list of line edits to one file, with a single read, write and patch.",
+		Fields: map[string]string{
+			"File":   "Path to the file.",
+			"Edits":  "The edits (as for LineInFile; their File field is ignored).",
+			"Create": "Create the file if it does not exist (otherwise, a missing file is an error).",
+			"Mode":   "Permissions of a created file (defaults to 0644).",
+			"Owner":  "Owner of a created file.",
+		},
+	})
+}
+
+func (fe FileEdits) ID() string {
+	short := fmt.Sprintf("FileEdits: file=%s, edits=%d", fe.File, len(fe.Edits))
+	long := []string{}
+	for _, lif := range fe.edits() {
+		long = append(long, strings.Replace(lif.ID(), "\n", " ", -1))
+	}
+	if fe.Create {
+		long = append(long, fmt.Sprintf("create=true mode=%o owner=%s", fe.Mode, fe.Owner))
+	}
+	return short + "\n" + strings.Join(long, "\n")
+}
+
+func (fe FileEdits) Files() []string {
+	return []string{fe.File}
+}
+
+func (fe FileEdits) Targets() []string {
+	return []string{fe.File}
+}
+
+// file returns a LineInFile which handles reading and writing the file.
+func (fe FileEdits) file() LineInFile {
+	return LineInFile{File: fe.File, Create: fe.Create, Mode: fe.Mode, Owner: fe.Owner}
+}
+
+// edits returns the list of edits, all pointing to the same file.
+func (fe FileEdits) edits() []LineInFile {
+	edits := make([]LineInFile, len(fe.Edits))
+	for k, lif := range fe.Edits {
+		lif.File = fe.File
+		edits[k] = lif
+	}
+	return edits
+}
+
+func (fe FileEdits) Remove() (string, error) {
+	fe.File = genesis.ExpandHome(fe.File)
+	err := genesis.Store.ApplyPatch(fe.File, fe.ID())
+	if err != nil {
+		return "Could not apply patch.", err
+	}
+	return "Patch applied", fe.file().removeCreated(fe.ID())
+}
+
+func (fe FileEdits) Status() (genesis.Status, string, error) {
+
+	fe.File = genesis.ExpandHome(fe.File)
+
+	lines, _, err := fe.file().readFile()
+	if err != nil {
+		return genesis.StatusFail, "Could not read file.", err
+	}
+
+	missing := []string{}
+	for k, lif := range fe.edits() {
+		if lif.isPresent(lines) == lif.Absent {
+			missing = append(missing, fmt.Sprintf("%d (%s)", k+1, strings.Join(lif.Line, ", ")))
+		}
+	}
+	if len(missing) > 0 {
+		return genesis.StatusFail, "Missing edits: " + strings.Join(missing, "; "), nil
+	}
+	return genesis.StatusPass, "All edits are in file.", nil
+
+}
+
+func (fe FileEdits) Install() (string, error) {
+
+	fe.File = genesis.ExpandHome(fe.File)
+
+	file := fe.file()
+	orig, exists, err := file.load()
+	if err != nil {
+		return "Could not read file.", err
+	}
+
+	lines, format := splitFile(orig)
+	for _, lif := range fe.edits() {
+		lines = lif.edit(lines)
+	}
+	content := format.join(lines)
+
+	err = file.save(content, exists, fe.ID())
+	if err != nil {
+		return "Unable to write file.", err
+	}
+
+	genesis.Store.SavePatch(fe.File, orig, content, fe.ID())
+
+	return fmt.Sprintf("Applied %d edits to file", len(fe.Edits)), nil
+
+}
@@ -0,0 +1,51 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func TestFileEdits(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sshd_config")
+	ioutil.WriteFile(filename, []byte("Port 22\nPermitRootLogin yes\nX11Forwarding yes\n"), 0644)
+
+	fe := FileEdits{
+		File: filename,
+		Edits: []LineInFile{
+			{Line: []string{"${1} no"}, Pattern: []string{"^(PermitRootLogin) "}, Expand: true},
+			{Line: []string{"${1} no"}, Pattern: []string{"^(X11Forwarding) "}, Expand: true},
+			{Line: []string{"Port 22"}, Pattern: []string{"^Port"}},
+		},
+	}
+
+	status, msg, _ := fe.Status()
+	if status != genesis.StatusFail || msg != "Missing edits: 1 (${1} no); 2 (${1} no)" {
+		t.Error("Status should report missing edits:", status, msg)
+	}
+
+	_, err = fe.Install()
+	if err != nil {
+		t.Error("Could not install edits:", err)
+	}
+	data, _ := ioutil.ReadFile(filename)
+	if string(data) != "Port 22\nPermitRootLogin no\nX11Forwarding no\n" {
+		t.Errorf("Edits were not applied: %q", data)
+	}
+
+	status, msg, _ = fe.Status()
+	if status != genesis.StatusPass {
+		t.Error("Status should pass after install:", msg)
+	}
+
+}
@@ -3,17 +3,30 @@ package modules
 import (
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
-	"os"
+	"path/filepath"
 
 	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
 )
 
+// HttpGet downloads a file to Dest.  If the installer was built with
+// "build -fetch", the file is taken from the archive instead of the network.
 type HttpGet struct {
-	Dest string
-	Url  string
+	Dest   string
+	Url    string
+	Sha256 string // optional checksum of the file
+}
+
+func init() {
+	genesis.RegisterModule("HttpGet", HttpGet{}, genesis.ModuleDoc{
+		Description: "Downloads a file (taken from the archive instead, if the installer was built with -fetch).",
+		Fields: map[string]string{
+			"Dest":   "Where to save the file.",
+			"Url":    "URL of the file.",
+			"Sha256": "Optional checksum of the file.",
+		},
+	})
 }
 
 func (get HttpGet) ID() string {
@@ -21,7 +34,21 @@ func (get HttpGet) ID() string {
 }
 
 func (get HttpGet) Files() []string {
-	return []string{}
+	return []string{genesis.RemoteFile(get.Url, get.Sha256)}
+}
+
+func (get HttpGet) Targets() []string {
+	return []string{get.Dest}
+}
+
+// fetch gets the file contents, preferring the copy embedded at build time.
+func (get HttpGet) fetch() ([]byte, error) {
+	embedded := filepath.Join(genesis.Tmpdir, genesis.RemotePath(get.Url))
+	body, err := ioutil.ReadFile(embedded)
+	if err != nil {
+		return genesis.Fetch(get.Url, get.Sha256)
+	}
+	return body, genesis.VerifyChecksum(body, get.Sha256)
 }
 
 func (get HttpGet) Remove() (string, error) {
@@ -32,6 +59,9 @@ func (get HttpGet) Remove() (string, error) {
 	if err == nil {
 		return "Successfully restored destination file.", nil
 	}
+	if err == store.ErrNoBackup {
+		return "No backup of destination file; leaving it in place.", nil
+	}
 	return "Failed to restore destination file.", err
 }
 
@@ -39,24 +69,17 @@ func (get HttpGet) Install() (string, error) {
 
 	get.Dest = genesis.ExpandHome(get.Dest)
 
-	err := genesis.Store.SaveFile(get.Dest, "")
-	if err != nil {
-		return "Could not save snapshot to file store.", err
-	}
-
-	out, err := os.Create(get.Dest)
+	body, err := get.fetch()
 	if err != nil {
-		return "Could not create destination file.", err
+		return "Could not fetch file.", err
 	}
-	defer out.Close()
 
-	resp, err := http.Get(get.Url)
+	err = genesis.Store.SaveFile(get.Dest, "")
 	if err != nil {
-		return "Could not fetch file.", err
+		return "Could not save snapshot to file store.", err
 	}
-	defer resp.Body.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	err = ioutil.WriteFile(get.Dest, body, 0644)
 	if err != nil {
 		return "Could not write to destination file.", err
 	}
@@ -74,12 +97,10 @@ func (get HttpGet) Status() (genesis.Status, string, error) {
 		return genesis.StatusFail, "Could not read destination file.", err
 	}
 
-	resp, err := http.Get(get.Url)
+	src, err := get.fetch()
 	if err != nil {
 		return genesis.StatusFail, "Could not fetch file.", err
 	}
-	defer resp.Body.Close()
-	src, err := ioutil.ReadAll(resp.Body)
 
 	if string(src) == string(dest) {
 		return genesis.StatusPass, "File has been downloaded.", nil
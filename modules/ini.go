@@ -0,0 +1,165 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// Ini sets a key within a section of an INI file.  Comments, ordering
+// and the key/value separator style are preserved.
+type Ini struct {
+	File    string
+	Section string // leave empty for keys before the first section
+	Key     string
+	Value   string
+	Absent  bool // ensure the key is not set
+}
+
+func init() {
+	genesis.RegisterModule("Ini", Ini{}, genesis.ModuleDoc{
+		Description: "Sets (or deletes) a key within a section of an INI file, preserving comments and ordering.",
+		Fields: map[string]string{
+			"File":    "Path to the file.",
+			"Section": "Section of the key; empty for keys before the first section.",
+			"Key":     "The key.",
+			"Value":   "The value.",
+			"Absent":  "Ensure the key is not set.",
+		},
+	})
+}
+
+func (ini Ini) ID() string {
+	return fmt.Sprintf("Ini: file=%s, section=%s, key=%s, value=%s, absent=%t", ini.File, ini.Section, ini.Key, ini.Value, ini.Absent)
+}
+
+func (ini Ini) Files() []string {
+	return []string{ini.File}
+}
+
+func (ini Ini) Targets() []string {
+	return []string{ini.File}
+}
+
+var iniSectionRe = regexp.MustCompile(`^\s*\[(.*)\]\s*$`)
+
+func (ini Ini) keyRegexp() *regexp.Regexp {
+	return regexp.MustCompile(`^(\s*` + regexp.QuoteMeta(ini.Key) + `\s*[=:]\s*)(.*)$`)
+}
+
+// section finds the line range of the section (the header line is
+// not included).  Returns -1, -1 if the section does not exist.
+func (ini Ini) section(lines []string) (int, int) {
+	start, stop := -1, len(lines)
+	if ini.Section == "" {
+		start = 0
+	}
+	for k, line := range lines {
+		m := iniSectionRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if start >= 0 {
+			stop = k
+			break
+		}
+		if strings.TrimSpace(m[1]) == ini.Section {
+			start = k + 1
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	return start, stop
+}
+
+// find looks for the key in the section, and returns the line index.
+func (ini Ini) find(lines []string) int {
+	start, stop := ini.section(lines)
+	if start < 0 {
+		return -1
+	}
+	re := ini.keyRegexp()
+	for k := start; k < stop; k++ {
+		if re.MatchString(lines[k]) {
+			return k
+		}
+	}
+	return -1
+}
+
+func (ini Ini) set(lines []string) []string {
+	edited := append([]string{}, lines...)
+	k := ini.find(lines)
+	if ini.Absent {
+		if k < 0 {
+			return edited
+		}
+		return append(edited[:k], edited[k+1:]...)
+	}
+	if k >= 0 {
+		m := ini.keyRegexp().FindStringSubmatch(lines[k])
+		edited[k] = m[1] + ini.Value
+		return edited
+	}
+	line := ini.Key + " = " + ini.Value
+	start, stop := ini.section(lines)
+	if start < 0 {
+		if len(edited) > 0 && strings.TrimSpace(edited[len(edited)-1]) != "" {
+			edited = append(edited, "")
+		}
+		return append(edited, "["+ini.Section+"]", line)
+	}
+	// Insert after the last non-blank line of the section.
+	k = stop
+	for k > start && strings.TrimSpace(lines[k-1]) == "" {
+		k--
+	}
+	return append(edited[:k], append([]string{line}, lines[k:]...)...)
+}
+
+func (ini Ini) Status() (genesis.Status, string, error) {
+	ini.File = genesis.ExpandHome(ini.File)
+	content, err := readConfig(ini.File)
+	if err != nil {
+		return genesis.StatusFail, "Could not read file.", err
+	}
+	lines, _ := splitFile(content)
+	k := ini.find(lines)
+	if ini.Absent {
+		if k >= 0 {
+			return genesis.StatusFail, "Key is set.", nil
+		}
+		return genesis.StatusPass, "Key is not set.", nil
+	}
+	if k < 0 {
+		return genesis.StatusFail, "Key is not set.", nil
+	}
+	value := strings.TrimSpace(ini.keyRegexp().FindStringSubmatch(lines[k])[2])
+	if value != ini.Value {
+		return genesis.StatusFail, fmt.Sprintf("Key is set to '%s'.", value), nil
+	}
+	return genesis.StatusPass, "Key is set.", nil
+}
+
+func (ini Ini) Install() (string, error) {
+	ini.File = genesis.ExpandHome(ini.File)
+	orig, err := readConfig(ini.File)
+	if err != nil {
+		return "Could not read file.", err
+	}
+	lines, format := splitFile(orig)
+	content := format.join(ini.set(lines))
+	err = writeConfig(ini.File, orig, content, ini.ID())
+	if err != nil {
+		return "Unable to write file.", err
+	}
+	return "Set key in file.", nil
+}
+
+func (ini Ini) Remove() (string, error) {
+	ini.File = genesis.ExpandHome(ini.File)
+	return removeConfig(ini.File, ini.ID())
+}
@@ -13,6 +13,15 @@ type Initd struct {
 	Name string
 }
 
+func init() {
+	genesis.RegisterModule("Initd", Initd{}, genesis.ModuleDoc{
+		Description: "Enables an init.d service (with update-rc.d), and starts it.",
+		Fields: map[string]string{
+			"Name": "Name of the service in /etc/init.d.",
+		},
+	})
+}
+
 func (initd Initd) ID() string {
 	return fmt.Sprintf("Initd: %s", initd.Name)
 }
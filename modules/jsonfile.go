@@ -0,0 +1,442 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// JSONFile sets (or deletes) a value in a JSON file.  The value is
+// addressed by a JSON pointer, such as "/log-opts/max-size".  Key
+// order and indentation are preserved.
+type JSONFile struct {
+	File   string
+	Path   string      // JSON pointer to the value ("/a/-" for an element of array a)
+	Value  interface{} // any value that can be marshaled to JSON
+	Absent bool        // ensure the value is not set
+}
+
+func init() {
+	genesis.RegisterModule("JSONFile", JSONFile{}, genesis.ModuleDoc{
+		Description: "Sets (or deletes) a value in a JSON file, preserving key order and indentation.",
+		Fields: map[string]string{
+			"File":   "Path to the file.",
+			"Path":   "JSON pointer to the value, e.g. \"/log-opts/max-size\".  A final \"-\" means an array element equal to Value.",
+			"Value":  "The value (any JSON value).",
+			"Absent": "Ensure the value is not set.",
+		},
+	})
+}
+
+func (jf JSONFile) ID() string {
+	value, _ := marshalJSON(jf.Value)
+	return fmt.Sprintf("JSONFile: file=%s, path=%s, value=%s, absent=%t", jf.File, jf.Path, value, jf.Absent)
+}
+
+func (jf JSONFile) Files() []string {
+	return []string{jf.File}
+}
+
+func (jf JSONFile) Targets() []string {
+	return []string{jf.File}
+}
+
+func (jf JSONFile) Status() (genesis.Status, string, error) {
+	jf.File = genesis.ExpandHome(jf.File)
+	content, err := readConfig(jf.File)
+	if err != nil {
+		return genesis.StatusFail, "Could not read file.", err
+	}
+	doc, err := decodeJSON([]byte(content))
+	if err != nil {
+		return genesis.StatusFail, "Could not parse file.", err
+	}
+	keys, element, err := elementPath(splitPointer(jf.Path))
+	if err != nil {
+		return genesis.StatusFail, "Invalid path.", err
+	}
+	want, err := jf.value()
+	if err != nil {
+		return genesis.StatusFail, "Could not encode value.", err
+	}
+	current, found := jsonGet(doc, keys)
+	if element {
+		found = len(jsonElements(current, want)) > 0
+		if found == jf.Absent {
+			return genesis.StatusFail, fmt.Sprintf("Element in array: %t.", found), nil
+		}
+		return genesis.StatusPass, fmt.Sprintf("Element in array: %t.", found), nil
+	}
+	if jf.Absent {
+		if found {
+			return genesis.StatusFail, "Value is set.", nil
+		}
+		return genesis.StatusPass, "Value is not set.", nil
+	}
+	if !found {
+		return genesis.StatusFail, "Value is not set.", nil
+	}
+	if !reflect.DeepEqual(jsonPlain(current), jsonPlain(want)) {
+		b, _ := encodeJSON(current, "")
+		return genesis.StatusFail, fmt.Sprintf("Value is set to %s.", b), nil
+	}
+	return genesis.StatusPass, "Value is set.", nil
+}
+
+func (jf JSONFile) Install() (string, error) {
+	jf.File = genesis.ExpandHome(jf.File)
+	orig, err := readConfig(jf.File)
+	if err != nil {
+		return "Could not read file.", err
+	}
+	doc, err := decodeJSON([]byte(orig))
+	if err != nil {
+		return "Could not parse file.", err
+	}
+	keys, element, err := elementPath(splitPointer(jf.Path))
+	if err != nil {
+		return "Invalid path.", err
+	}
+	value, err := jf.value()
+	if err != nil {
+		return "Could not encode value.", err
+	}
+	switch {
+	case element:
+		doc, err = jsonSetElement(doc, keys, value, jf.Absent)
+	case jf.Absent:
+		doc = jsonDelete(doc, keys)
+	default:
+		doc, err = jsonSet(doc, keys, value)
+	}
+	if err != nil {
+		return "Could not set value.", err
+	}
+	b, err := encodeJSON(doc, jsonIndent(orig))
+	if err != nil {
+		return "Could not encode file.", err
+	}
+	content := string(b)
+	if len(orig) == 0 || strings.HasSuffix(orig, "\n") {
+		content += "\n"
+	}
+	err = writeConfig(jf.File, orig, content, jf.ID())
+	if err != nil {
+		return "Unable to write file.", err
+	}
+	return "Set value in file.", nil
+}
+
+func (jf JSONFile) Remove() (string, error) {
+	jf.File = genesis.ExpandHome(jf.File)
+	return removeConfig(jf.File, jf.ID())
+}
+
+// value converts the user's value into the same form as a decoded document.
+func (jf JSONFile) value() (interface{}, error) {
+	b, err := marshalJSON(jf.Value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
+
+// jsonObject is a JSON object which remembers the order of its keys.
+type jsonObject struct {
+	keys []string
+	vals map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{vals: make(map[string]interface{})}
+}
+
+func (obj *jsonObject) set(key string, value interface{}) {
+	if _, ok := obj.vals[key]; !ok {
+		obj.keys = append(obj.keys, key)
+	}
+	obj.vals[key] = value
+}
+
+func (obj *jsonObject) delete(key string) {
+	if _, ok := obj.vals[key]; !ok {
+		return
+	}
+	delete(obj.vals, key)
+	for k, name := range obj.keys {
+		if name == key {
+			obj.keys = append(obj.keys[:k], obj.keys[k+1:]...)
+			break
+		}
+	}
+}
+
+// decodeJSON decodes a document into *jsonObject, []interface{}, json.Number,
+// string, bool or nil.  An empty document decodes to an empty object.
+func decodeJSON(data []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return newJSONObject(), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return decodeJSONValue(dec)
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := newJSONObject()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(key.(string), value)
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// encodeJSON encodes a decoded document, with the given indentation
+// (no indentation if empty).
+func encodeJSON(doc interface{}, indent string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := encodeJSONValue(buf, doc)
+	if err != nil || len(indent) == 0 {
+		return buf.Bytes(), err
+	}
+	out := new(bytes.Buffer)
+	err = json.Indent(out, buf.Bytes(), "", indent)
+	return out.Bytes(), err
+}
+
+func encodeJSONValue(buf *bytes.Buffer, doc interface{}) error {
+	switch v := doc.(type) {
+	case *jsonObject:
+		buf.WriteString("{")
+		for k, key := range v.keys {
+			if k > 0 {
+				buf.WriteString(",")
+			}
+			b, _ := marshalJSON(key)
+			buf.Write(b)
+			buf.WriteString(":")
+			err := encodeJSONValue(buf, v.vals[key])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	case []interface{}:
+		buf.WriteString("[")
+		for k, value := range v {
+			if k > 0 {
+				buf.WriteString(",")
+			}
+			err := encodeJSONValue(buf, value)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	default:
+		b, err := marshalJSON(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// marshalJSON is like json.Marshal, but does not escape HTML characters.
+func marshalJSON(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), err
+}
+
+// jsonIndent guesses the indentation used by a document.  A document
+// without indentation (e.g. on one line) is kept compact, but a new
+// document is indented.
+func jsonIndent(content string) string {
+	m := regexp.MustCompile(`(?m)^([ \t]+)\S`).FindStringSubmatch(content)
+	if m != nil {
+		return m[1]
+	}
+	if len(strings.TrimSpace(content)) > 0 {
+		return ""
+	}
+	return "  "
+}
+
+// jsonPlain converts a decoded document into plain maps and floats, for comparison.
+func jsonPlain(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case *jsonObject:
+		m := make(map[string]interface{})
+		for key, value := range v.vals {
+			m[key] = jsonPlain(value)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for k, value := range v {
+			arr[k] = jsonPlain(value)
+		}
+		return arr
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return doc
+}
+
+func jsonGet(doc interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		switch v := doc.(type) {
+		case *jsonObject:
+			value, ok := v.vals[key]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			k, err := strconv.Atoi(key)
+			if err != nil || k < 0 || k >= len(v) {
+				return nil, false
+			}
+			doc = v[k]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// jsonSet sets a value, creating intermediate objects as needed.
+func jsonSet(doc interface{}, keys []string, value interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	key := keys[0]
+	switch v := doc.(type) {
+	case *jsonObject:
+		child, ok := v.vals[key]
+		if !ok {
+			child = newJSONObject()
+		}
+		child, err := jsonSet(child, keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v.set(key, child)
+		return v, nil
+	case []interface{}:
+		k, err := strconv.Atoi(key)
+		if err != nil || k < 0 || k >= len(v) {
+			return nil, fmt.Errorf("invalid array index: %s", key)
+		}
+		v[k], err = jsonSet(v[k], keys[1:], value)
+		return v, err
+	}
+	return nil, errors.New("cannot set a key on a scalar value: " + strings.Join(keys, "/"))
+}
+
+func jsonDelete(doc interface{}, keys []string) interface{} {
+	if len(keys) == 0 {
+		return doc
+	}
+	parent, ok := jsonGet(doc, keys[:len(keys)-1])
+	if !ok {
+		return doc
+	}
+	key := keys[len(keys)-1]
+	switch v := parent.(type) {
+	case *jsonObject:
+		v.delete(key)
+	case []interface{}:
+		k, err := strconv.Atoi(key)
+		if err == nil && k >= 0 && k < len(v) {
+			arr := append(v[:k:k], v[k+1:]...)
+			doc, _ = jsonSet(doc, keys[:len(keys)-1], arr)
+		}
+	}
+	return doc
+}
+
+// jsonElements returns the indices of the elements of an array which
+// are equal to value.
+func jsonElements(arr interface{}, value interface{}) []int {
+	v, _ := arr.([]interface{})
+	indices := []int{}
+	for k, elem := range v {
+		if reflect.DeepEqual(jsonPlain(elem), jsonPlain(value)) {
+			indices = append(indices, k)
+		}
+	}
+	return indices
+}
+
+// jsonSetElement appends value to the array at keys, unless the array
+// already has an equal element.  With absent, it removes all equal
+// elements instead.
+func jsonSetElement(doc interface{}, keys []string, value interface{}, absent bool) (interface{}, error) {
+	current, found := jsonGet(doc, keys)
+	arr, ok := current.([]interface{})
+	if found && !ok {
+		return nil, errors.New("not an array: /" + strings.Join(keys, "/"))
+	}
+	indices := jsonElements(arr, value)
+	if absent {
+		if len(indices) == 0 {
+			return doc, nil
+		}
+		kept := []interface{}{}
+		for k, elem := range arr {
+			if len(indices) > 0 && indices[0] == k {
+				indices = indices[1:]
+				continue
+			}
+			kept = append(kept, elem)
+		}
+		return jsonSet(doc, keys, kept)
+	}
+	if len(indices) > 0 {
+		return doc, nil
+	}
+	if arr == nil {
+		arr = []interface{}{}
+	}
+	return jsonSet(doc, keys, append(arr, value))
+}
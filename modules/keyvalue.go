@@ -0,0 +1,191 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wx13/genesis"
+)
+
+// KeyValue sets a variable in a shell-style KEY=value file, such as
+// the files in /etc/default.  Comments and ordering are preserved.
+type KeyValue struct {
+	File   string
+	Key    string
+	Value  string
+	Absent bool // ensure the key is not set
+}
+
+func init() {
+	genesis.RegisterModule("KeyValue", KeyValue{}, genesis.ModuleDoc{
+		Description: "Sets (or deletes) a variable in a shell-style KEY=value file, such as those in /etc/default.",
+		Fields: map[string]string{
+			"File":   "Path to the file.",
+			"Key":    "The variable.",
+			"Value":  "The value.",
+			"Absent": "Ensure the variable is not set.",
+		},
+	})
+}
+
+func (kv KeyValue) ID() string {
+	return fmt.Sprintf("KeyValue: file=%s, key=%s, value=%s, absent=%t", kv.File, kv.Key, kv.Value, kv.Absent)
+}
+
+func (kv KeyValue) Files() []string {
+	return []string{kv.File}
+}
+
+func (kv KeyValue) Targets() []string {
+	return []string{kv.File}
+}
+
+func (kv KeyValue) regexp() *regexp.Regexp {
+	return regexp.MustCompile(`^(\s*(?:export\s+)?` + regexp.QuoteMeta(kv.Key) + `=)(.*)$`)
+}
+
+// get returns the value of the key (the last assignment wins).
+func (kv KeyValue) get(lines []string) (string, bool) {
+	re := kv.regexp()
+	value, found := "", false
+	for _, line := range lines {
+		m := re.FindStringSubmatch(line)
+		if m != nil {
+			value, found = parseShellValue(m[2]), true
+		}
+	}
+	return value, found
+}
+
+// set updates every assignment of the key, or appends one if there are none.
+// If Absent is set, it removes all assignments instead.
+func (kv KeyValue) set(lines []string) []string {
+	re := kv.regexp()
+	edited := []string{}
+	found := false
+	for _, line := range lines {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			edited = append(edited, line)
+			continue
+		}
+		found = true
+		if !kv.Absent {
+			_, comment := splitShellComment(m[2])
+			edited = append(edited, m[1]+formatShellValue(kv.Value)+comment)
+		}
+	}
+	if !found && !kv.Absent {
+		edited = append(edited, kv.Key+"="+formatShellValue(kv.Value))
+	}
+	return edited
+}
+
+func (kv KeyValue) Status() (genesis.Status, string, error) {
+	kv.File = genesis.ExpandHome(kv.File)
+	content, err := readConfig(kv.File)
+	if err != nil {
+		return genesis.StatusFail, "Could not read file.", err
+	}
+	lines, _ := splitFile(content)
+	value, found := kv.get(lines)
+	if kv.Absent {
+		if found {
+			return genesis.StatusFail, "Key is set.", nil
+		}
+		return genesis.StatusPass, "Key is not set.", nil
+	}
+	if !found {
+		return genesis.StatusFail, "Key is not set.", nil
+	}
+	if value != kv.Value {
+		return genesis.StatusFail, fmt.Sprintf("Key is set to '%s'.", value), nil
+	}
+	return genesis.StatusPass, "Key is set.", nil
+}
+
+func (kv KeyValue) Install() (string, error) {
+	kv.File = genesis.ExpandHome(kv.File)
+	orig, err := readConfig(kv.File)
+	if err != nil {
+		return "Could not read file.", err
+	}
+	lines, format := splitFile(orig)
+	content := format.join(kv.set(lines))
+	err = writeConfig(kv.File, orig, content, kv.ID())
+	if err != nil {
+		return "Unable to write file.", err
+	}
+	return "Set key in file.", nil
+}
+
+func (kv KeyValue) Remove() (string, error) {
+	kv.File = genesis.ExpandHome(kv.File)
+	return removeConfig(kv.File, kv.ID())
+}
+
+// parseShellValue strips quotes and trailing comments from a shell value.
+func parseShellValue(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '\'' {
+		if k := strings.Index(s[1:], "'"); k >= 0 {
+			return s[1 : k+1]
+		}
+	}
+	if len(s) >= 2 && s[0] == '"' {
+		value := ""
+		for k := 1; k < len(s); k++ {
+			if s[k] == '\\' && k+1 < len(s) {
+				k++
+			} else if s[k] == '"' {
+				return value
+			}
+			value += string(s[k])
+		}
+		return value
+	}
+	s, _ = splitShellComment(s)
+	return s
+}
+
+var shellCommentRe = regexp.MustCompile(`\s+#`)
+
+// splitShellComment splits a shell value from a trailing comment.  The
+// comment keeps the space before the "#".
+func splitShellComment(s string) (string, string) {
+	end := -1
+	switch {
+	case strings.HasPrefix(s, "'"):
+		if k := strings.Index(s[1:], "'"); k >= 0 {
+			end = k + 2
+		}
+	case strings.HasPrefix(s, `"`):
+		for k := 1; k < len(s); k++ {
+			if s[k] == '\\' {
+				k++
+			} else if s[k] == '"' {
+				end = k + 1
+				break
+			}
+		}
+	default:
+		if m := shellCommentRe.FindStringIndex(s); m != nil {
+			return s[:m[0]], s[m[0]:]
+		}
+		return s, ""
+	}
+	if end >= 0 && strings.HasPrefix(strings.TrimSpace(s[end:]), "#") {
+		return s[:end], s[end:]
+	}
+	return s, ""
+}
+
+// formatShellValue quotes a value if needed.
+func formatShellValue(s string) string {
+	if regexp.MustCompile(`^[A-Za-z0-9_./:,@%+=-]*$`).MatchString(s) {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(s) + `"`
+}
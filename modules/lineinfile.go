@@ -3,10 +3,12 @@ package modules
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"regexp"
 	"strings"
 
 	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
 )
 
 // LineInFile lets the user insert lines of text into a file.
@@ -17,17 +19,55 @@ type LineInFile struct {
 	Line []string // line(s) to insert
 
 	// Optional
-	Pattern []string // line(s) to replace
-	Success []string // pattern to check for success (defaults to Line)
-	Before  []string // insert line before this pattern
-	After   []string // insert line after this pattern
-	Absent  bool     // ensure line is absent from file
+	Pattern    []string // line(s) to replace
+	Success    []string // pattern to check for success (defaults to Line)
+	Before     []string // insert line before this pattern
+	After      []string // insert line after this pattern
+	Absent     bool     // ensure line is absent from file
+	Expand     bool     // expand capture groups (${1}, ${name}) from Pattern in Line
+	ReplaceAll bool     // replace every occurrence of the pattern, not just the first
+
+	// Optional, for creating a file that does not exist
+	Create bool        // create the file if it does not exist (otherwise, an error)
+	Mode   os.FileMode // permissions of created file (defaults to 0644)
+	Owner  string      // owner of created file
 
 }
 
+func init() {
+	genesis.RegisterModule("LineInFile", LineInFile{}, genesis.ModuleDoc{
+		Description: "Inserts (or replaces, or removes) lines of text in a file.",
+		Fields: map[string]string{
+			"File":       "Path to the file.",
+			"Line":       "Line(s) to insert.",
+			"Pattern":    "Pattern(s) of the line(s) to replace.",
+			"Success":    "Pattern(s) to check for success (defaults to Pattern).",
+			"Before":     "Insert the line(s) before this pattern.",
+			"After":      "Insert the line(s) after this pattern.",
+			"Absent":     "Ensure the line(s) are not in the file.",
+			"Expand":     "Expand capture groups (${1}, ${name}) from Pattern in Line.",
+			"ReplaceAll": "Replace every occurrence of the pattern, not just the first.",
+			"Create":     "Create the file if it does not exist (otherwise, a missing file is an error).",
+			"Mode":       "Permissions of a created file (defaults to 0644).",
+			"Owner":      "Owner of a created file.",
+		},
+	})
+}
+
 func (lif LineInFile) ID() string {
 	short := fmt.Sprintf("LineInFile: file=%s, line=%s, pattern=%s", lif.File, lif.Line, lif.Pattern)
-	long := fmt.Sprintf("before=%s, after=%s, success=%s absent=%s", lif.Before, lif.After, lif.Success, lif.Absent)
+	// Absent is spelled as it was printed by the old "%s" verb, so that the
+	// ID (which names the task in the store) does not change.
+	long := fmt.Sprintf("before=%s, after=%s, success=%s absent=%%!s(bool=%t)", lif.Before, lif.After, lif.Success, lif.Absent)
+	if lif.Expand {
+		long += " expand=true"
+	}
+	if lif.ReplaceAll {
+		long += " replaceall=true"
+	}
+	if lif.Create {
+		long += fmt.Sprintf(" create=true mode=%o owner=%s", lif.Mode, lif.Owner)
+	}
 	return short + "\n" + long
 }
 
@@ -35,27 +75,29 @@ func (lif LineInFile) Files() []string {
 	return []string{lif.File}
 }
 
+func (lif LineInFile) Targets() []string {
+	return []string{lif.File}
+}
+
 func (lif LineInFile) Remove() (string, error) {
 	lif.File = genesis.ExpandHome(lif.File)
 	err := genesis.Store.ApplyPatch(lif.File, lif.ID())
 	if err != nil {
 		return "Could not apply patch.", err
 	}
-	return "Patch applied", nil
+	return "Patch applied", lif.removeCreated(lif.ID())
 }
 
 func (lif LineInFile) Status() (genesis.Status, string, error) {
 
 	lif.File = genesis.ExpandHome(lif.File)
 
-	lines, err := lif.readFile()
+	lines, _, err := lif.readFile()
 	if err != nil {
 		return genesis.StatusFail, "Could not read file.", err
 	}
 
-	_, lines, _ = lif.split(lines, lif.After, lif.Before)
-
-	present, _, _ := lif.find(lines)
+	present := lif.isPresent(lines)
 	if present {
 		if lif.Absent {
 			return genesis.StatusFail, "Line is in file.", nil
@@ -76,51 +118,260 @@ func (lif LineInFile) Install() (string, error) {
 
 	lif.File = genesis.ExpandHome(lif.File)
 
-	lines, _ := lif.readFile()
-	origLines := strings.Join(lines, "\n")
-
-	beg, mid, end := lif.split(lines, lif.After, lif.Before)
+	orig, exists, err := lif.load()
+	if err != nil {
+		return "Could not read file.", err
+	}
 
-	mid = lif.replace(mid)
-	lines = append(beg, append(mid, end...)...)
+	lines, format := splitFile(orig)
+	content := format.join(lif.edit(lines))
 
-	err := lif.writeFile(lines)
+	err = lif.save(content, exists, lif.ID())
 	if err != nil {
 		return "Unable to write file.", err
 	}
 
-	genesis.Store.SavePatch(lif.File, origLines, strings.Join(lines, "\n"), lif.ID())
+	genesis.Store.SavePatch(lif.File, orig, content, lif.ID())
 
 	return "Wrote line to file", nil
 
 }
 
+// isPresent checks if the line (or Success pattern) is in the file
+// contents, between the After and Before patterns.
+func (lif LineInFile) isPresent(lines []string) bool {
+	_, lines, _ = lif.split(lines, lif.After, lif.Before)
+	if lif.ReplaceAll && !lif.Absent {
+		return lif.allReplaced(lines)
+	}
+	present, start, stop := lif.find(lines)
+	if present && lif.Expand && len(lif.Success) == 0 {
+		line := lif.expand(lines[start:])
+		present = strings.Join(line, "\n") == strings.Join(lines[start:stop+1], "\n")
+	}
+	return present
+}
+
+// edit applies the change to the file contents.  It does not
+// modify the input slice.
+func (lif LineInFile) edit(lines []string) []string {
+	beg, mid, end := lif.split(lines, lif.After, lif.Before)
+	mid = lif.replace(append([]string{}, mid...))
+	edited := append([]string{}, beg...)
+	edited = append(edited, mid...)
+	return append(edited, end...)
+}
+
 // replace either replaces pattern line with line, or inserts
 // the line at the end.
 func (lif *LineInFile) replace(lines []string) []string {
+	if lif.ReplaceAll {
+		return lif.replaceAll(lines)
+	}
+	line := lif.expand(lines)
 	present, start, stop := lif.find(lines)
 	if !present {
-		return append(lines, lif.Line...)
+		return append(lines, line...)
 	}
 	if stop == len(lines)-1 {
-		return append(lines[:start], lif.Line...)
+		return append(lines[:start], line...)
+	}
+	return append(lines[:start], append(line, lines[stop+1:]...)...)
+}
+
+// replaceAll is like replace, but replaces every occurrence of the pattern.
+// If there are none, the line is inserted at the end (unless it is there
+// already, or it would be expanded without any captures).
+func (lif *LineInFile) replaceAll(lines []string) []string {
+	replaced := []string{}
+	rest := lines
+	for {
+		present, start, stop := lif.findPattern(rest, lif.Pattern)
+		if !present {
+			break
+		}
+		replaced = append(replaced, rest[:start]...)
+		replaced = append(replaced, lif.expand(rest[start:])...)
+		rest = rest[stop+1:]
+	}
+	if len(rest) < len(lines) {
+		return append(replaced, rest...)
+	}
+	if (lif.Expand && len(lif.Pattern) > 0) || lif.hasLine(lines) {
+		return lines
+	}
+	return append(lines, lif.Line...)
+}
+
+// allReplaced checks that replaceAll would not change anything, and
+// that the Success pattern (if any) is found.
+func (lif LineInFile) allReplaced(lines []string) bool {
+	replaced := lif.replaceAll(append([]string{}, lines...))
+	if strings.Join(replaced, "\n") != strings.Join(lines, "\n") {
+		return false
 	}
-	return append(lines[:start], append(lif.Line, lines[stop+1:]...)...)
+	if len(lif.Success) > 0 {
+		present, _, _ := lif.findPattern(lines, lif.Success)
+		return present
+	}
+	return true
+}
+
+// hasLine checks if the (unexpanded) lines are in the file, in order.
+func (lif LineInFile) hasLine(lines []string) bool {
+	for k := 0; k+len(lif.Line) <= len(lines); k++ {
+		if strings.Join(lines[k:k+len(lif.Line)], "\n") == strings.Join(lif.Line, "\n") {
+			return true
+		}
+	}
+	return false
 }
 
-func (lif LineInFile) readFile() ([]string, error) {
+// expand substitutes capture groups from Pattern into Line (if Expand is set).
+// Line k uses the captures from Pattern k, or from the last pattern line if
+// there are more lines than patterns.  If the pattern is not found, the
+// capture groups expand to empty strings.
+func (lif LineInFile) expand(lines []string) []string {
+	if !lif.Expand || len(lif.Pattern) == 0 {
+		return lif.Line
+	}
+	idx := lif.matchLines(lines, lif.Pattern)
+	expanded := make([]string, len(lif.Line))
+	for k, line := range lif.Line {
+		j := k
+		if j >= len(lif.Pattern) {
+			j = len(lif.Pattern) - 1
+		}
+		re, err := regexp.Compile(lif.Pattern[j])
+		if err != nil {
+			expanded[k] = line
+			continue
+		}
+		src := ""
+		var match []int
+		if idx != nil {
+			src = lines[idx[j]]
+			match = re.FindStringSubmatchIndex(src)
+		}
+		expanded[k] = string(re.ExpandString(nil, line, src, match))
+	}
+	return expanded
+}
+
+func (lif LineInFile) readFile() ([]string, lineFormat, error) {
+	content, err := ioutil.ReadFile(lif.File)
+	if err != nil {
+		return []string{}, lineFormat{}, err
+	}
+	lines, format := splitFile(string(content))
+	return lines, format, nil
+}
+
+// load reads the file contents.  A missing file is only an
+// error if Create is not set.
+func (lif LineInFile) load() (string, bool, error) {
 	content, err := ioutil.ReadFile(lif.File)
+	if os.IsNotExist(err) && lif.Create {
+		return "", false, nil
+	}
+	return string(content), err == nil, err
+}
+
+// save writes the file contents.  An existing file keeps its
+// permissions; a new file gets Mode and Owner, and the store records
+// (under label) that it did not exist.
+func (lif LineInFile) save(content string, exists bool, label string) error {
+	if exists {
+		info, err := os.Stat(lif.File)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(lif.File, []byte(content), info.Mode())
+	}
+	err := genesis.Store.SaveFile(lif.File, label)
 	if err != nil {
-		return []string{}, err
+		return err
 	}
-	lines := strings.Split(string(content), "\n")
-	return lines, nil
+	mode := lif.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	err = ioutil.WriteFile(lif.File, []byte(content), mode)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(lif.File, mode)
+	if err != nil || len(lif.Owner) == 0 {
+		return err
+	}
+	uid, gid, err := lookupOwner(lif.Owner)
+	if err != nil {
+		return err
+	}
+	return os.Chown(lif.File, uid, gid)
 }
 
-func (lif LineInFile) writeFile(lines []string) error {
-	content := strings.Join(lines, "\n") + "\n"
-	err := ioutil.WriteFile(lif.File, []byte(content), 0644)
-	return err
+// removeCreated removes the file if it was created by Install.
+func (lif LineInFile) removeCreated(label string) error {
+	if !lif.Create {
+		return nil
+	}
+	return removeCreatedFile(lif.File, label)
+}
+
+// removeCreatedFile removes a file if the store shows (under label) that
+// it was created, and it is now empty (i.e. all changes have been
+// reversed).
+func removeCreatedFile(file, label string) error {
+	gens, err := genesis.Store.Generations(file, label)
+	if err != nil || len(gens) == 0 || !gens[0].Missing {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil || info.Size() > 0 {
+		return nil
+	}
+	err = os.Remove(file)
+	if err != nil {
+		return err
+	}
+	return genesis.Store.RemoveEntry(store.Entry{Path: file, Label: label, Kind: "file"})
+}
+
+// lineFormat remembers the line endings of a file, so that
+// it can be written back faithfully.
+type lineFormat struct {
+	eol   string // "\n" or "\r\n"
+	final bool   // the last line has a line ending
+}
+
+// splitFile splits file contents into lines.
+func splitFile(content string) ([]string, lineFormat) {
+	format := lineFormat{eol: "\n", final: true}
+	if len(content) == 0 {
+		return []string{}, format
+	}
+	if strings.Contains(content, "\r\n") {
+		format.eol = "\r\n"
+	}
+	format.final = strings.HasSuffix(content, "\n")
+	content = strings.TrimSuffix(content, "\n")
+	if format.eol == "\r\n" {
+		content = strings.TrimSuffix(content, "\r")
+	}
+	return strings.Split(content, format.eol), format
+}
+
+// join is the inverse of splitFile.
+func (format lineFormat) join(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	content := strings.Join(lines, format.eol)
+	if format.final {
+		content += format.eol
+	}
+	return content
 }
 
 // findPattern looks for a line that matches the lif.Pattern (or Success) regex.
@@ -156,6 +407,25 @@ func (lif LineInFile) findPattern(lines []string, pattern []string) (bool, int,
 	return false, -1, -1
 }
 
+// matchLines is like findPattern, but returns the index of the line
+// matched by each pattern line (or nil if the pattern is not found).
+func (lif LineInFile) matchLines(lines []string, pattern []string) []int {
+	idx := []int{}
+	for k, line := range lines {
+		if len(idx) >= len(pattern) {
+			break
+		}
+		match, _ := regexp.MatchString(pattern[len(idx)], line)
+		if match {
+			idx = append(idx, k)
+		}
+	}
+	if len(pattern) == 0 || len(idx) < len(pattern) {
+		return nil
+	}
+	return idx
+}
+
 // Grab the lines between start and end (exclusive).
 func (lif LineInFile) split(lines []string, sPtrn, ePtrn []string) (beg, mid, end []string) {
 
@@ -1,8 +1,14 @@
 package modules
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
 )
 
 func TestFindPattern(t *testing.T) {
@@ -109,3 +115,208 @@ func TestReplace(t *testing.T) {
 	}
 
 }
+
+func TestLineInFileID(t *testing.T) {
+
+	// The ID names the task in the store, so it must not change.
+	lif := LineInFile{File: "/etc/hosts", Line: []string{"127.0.0.1 host"}, Absent: true}
+	want := "LineInFile: file=/etc/hosts, line=[127.0.0.1 host], pattern=[]\n" +
+		"before=[], after=[], success=[] absent=%!s(bool=true)"
+	if lif.ID() != want {
+		t.Errorf("ID is %q, want %q", lif.ID(), want)
+	}
+
+}
+
+func TestExpand(t *testing.T) {
+
+	lif := LineInFile{
+		Line:    []string{"${1}PermitRootLogin no"},
+		Pattern: []string{`^(\s*)PermitRootLogin .*`},
+	}
+	file := []string{"Port 22", "    PermitRootLogin yes", "UsePAM yes"}
+
+	// Without Expand, the line is literal.
+	lines := lif.replace(append([]string{}, file...))
+	if lines[1] != "${1}PermitRootLogin no" {
+		t.Error("Line should not have been expanded ==>", lines)
+	}
+
+	// With Expand, indentation is preserved.
+	lif.Expand = true
+	lines = lif.replace(append([]string{}, file...))
+	if strings.Join(lines, ":") != "Port 22:    PermitRootLogin no:UsePAM yes" {
+		t.Error("Capture group was not expanded ==>", lines)
+	}
+
+	// Pattern not found: capture groups are empty.
+	lines = lif.replace([]string{"Port 22"})
+	if strings.Join(lines, ":") != "Port 22:PermitRootLogin no" {
+		t.Error("Unmatched capture group should be empty ==>", lines)
+	}
+
+	// Multi-line pattern: each line uses its own pattern's captures.
+	lif.Pattern = []string{`^\[(\w+)\]`, `^(\s*)key=`}
+	lif.Line = []string{"[$1]", "${1}key=new"}
+	lines = lif.replace([]string{"[main]", "  other=1", "  key=old"})
+	if strings.Join(lines, ":") != "[main]:  key=new" {
+		t.Error("Multi-line capture groups were not expanded ==>", lines)
+	}
+
+}
+
+func TestReplaceAll(t *testing.T) {
+
+	lif := LineInFile{
+		Line:       []string{"${1}=no"},
+		Pattern:    []string{`^(\w+)=yes`},
+		Expand:     true,
+		ReplaceAll: true,
+	}
+	lines := lif.replace([]string{"a=yes", "b=no", "c=yes"})
+	if strings.Join(lines, ":") != "a=no:b=no:c=no" {
+		t.Error("All occurrences should be replaced ==>", lines)
+	}
+
+	// No occurrences, and nothing to expand from: leave the file alone.
+	lines = lif.replace([]string{"b=no"})
+	if strings.Join(lines, ":") != "b=no" {
+		t.Error("Nothing should be inserted without captures ==>", lines)
+	}
+
+	// No occurrences: insert line at end, once.
+	lif.Line = []string{"d=no"}
+	lif.Expand = false
+	lines = lif.replace([]string{"b=no"})
+	if strings.Join(lines, ":") != "b=no:d=no" {
+		t.Error("Line should be inserted at end ==>", lines)
+	}
+	lines = lif.replace(lines)
+	if strings.Join(lines, ":") != "b=no:d=no" {
+		t.Error("Line should not be inserted twice ==>", lines)
+	}
+
+}
+
+func TestReplaceAllIdempotent(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	genesis.Store = store.NewMemory()
+	defer func() { genesis.Store = nil }()
+
+	filename := filepath.Join(dir, "flags")
+	ioutil.WriteFile(filename, []byte("a=yes\nb=no\nc=yes\n"), 0644)
+	lif := LineInFile{
+		File:       filename,
+		Line:       []string{"${1}=no"},
+		Pattern:    []string{`^(\w+)=yes`},
+		Expand:     true,
+		ReplaceAll: true,
+	}
+
+	status, _, _ := lif.Status()
+	if status != genesis.StatusFail {
+		t.Error("Status should fail while occurrences remain.")
+	}
+
+	// The first occurrence is right, but a later one is not.
+	lif.Pattern = []string{`^(\w+)=(yes|no)`}
+	ioutil.WriteFile(filename, []byte("a=no\nb=no\nc=yes\n"), 0644)
+	status, _, _ = lif.Status()
+	if status != genesis.StatusFail {
+		t.Error("Status should fail while a later occurrence remains.")
+	}
+
+	for k := 0; k < 2; k++ {
+		lif.Install()
+		data, _ := ioutil.ReadFile(filename)
+		if string(data) != "a=no\nb=no\nc=no\n" {
+			t.Errorf("Unexpected content after install %d: %q", k+1, data)
+		}
+		status, msg, _ := lif.Status()
+		if status != genesis.StatusPass {
+			t.Errorf("Status should pass after install %d: %s", k+1, msg)
+		}
+	}
+
+}
+
+func TestSplitFile(t *testing.T) {
+
+	for _, content := range []string{"", "a", "a\n", "a\nb\n", "a\r\nb\r\n", "a\r\nb", "a\n\n"} {
+		lines, format := splitFile(content)
+		if format.join(lines) != content {
+			t.Errorf("Split/join is not byte-stable: %q ==> %q", content, format.join(lines))
+		}
+	}
+
+	lines, _ := splitFile("a\r\nb\r\n")
+	if strings.Join(lines, ":") != "a:b" {
+		t.Error("CRLF lines should not contain carriage returns ==>", lines)
+	}
+
+}
+
+func TestLineInFileCycle(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	genesis.Store = store.NewMemory()
+	defer func() { genesis.Store = nil }()
+
+	// Existing CRLF file keeps its mode and line endings.
+	filename := filepath.Join(dir, "config.ini")
+	content := "[main]\r\nkey=1\r\n"
+	ioutil.WriteFile(filename, []byte(content), 0600)
+	lif := LineInFile{File: filename, Line: []string{"key=2"}, Pattern: []string{"^key="}}
+	for k := 0; k < 2; k++ {
+		lif.Install()
+		data, _ := ioutil.ReadFile(filename)
+		if string(data) != "[main]\r\nkey=2\r\n" {
+			t.Errorf("Unexpected content after install: %q", data)
+		}
+		lif.Remove()
+		data, _ = ioutil.ReadFile(filename)
+		if string(data) != content {
+			t.Errorf("Install/remove cycle is not byte-stable: %q", data)
+		}
+	}
+	info, _ := os.Stat(filename)
+	if info.Mode().Perm() != 0600 {
+		t.Error("File mode was not preserved:", info.Mode())
+	}
+
+	// Missing file is an error, unless Create is set.
+	lif.File = filepath.Join(dir, "new.conf")
+	_, err = lif.Install()
+	if err == nil {
+		t.Error("Install should fail on a missing file.")
+	}
+	lif.Create = true
+	lif.Mode = 0640
+	lif.Install()
+	info, err = os.Stat(lif.File)
+	if err != nil || info.Mode().Perm() != 0640 {
+		t.Error("File should be created with mode 0640:", err)
+	}
+	lif.Remove()
+	if genesis.FileExists(lif.File) {
+		t.Error("Created file should be removed.")
+	}
+
+	// An empty file which existed before install is kept.
+	ioutil.WriteFile(lif.File, []byte{}, 0600)
+	lif.Install()
+	lif.Remove()
+	if !genesis.FileExists(lif.File) {
+		t.Error("Existing empty file should not be removed.")
+	}
+
+}
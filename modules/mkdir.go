@@ -14,6 +14,17 @@ type Mkdir struct {
 	Empty  bool
 }
 
+func init() {
+	genesis.RegisterModule("Mkdir", Mkdir{}, genesis.ModuleDoc{
+		Description: "Creates a directory (or removes it, or empties it).",
+		Fields: map[string]string{
+			"Path":   "Path to the directory.",
+			"Absent": "Ensure the directory does not exist.",
+			"Empty":  "Ensure the directory is empty.",
+		},
+	})
+}
+
 func (mkdir Mkdir) ID() string {
 	return fmt.Sprintf("Mkdir: %+v", mkdir)
 }
@@ -22,6 +33,10 @@ func (mkdir Mkdir) Files() []string {
 	return []string{}
 }
 
+func (mkdir Mkdir) Targets() []string {
+	return []string{mkdir.Path}
+}
+
 func (mkdir Mkdir) isExist() bool {
 	_, err := os.Stat(mkdir.Path)
 	if err == nil {
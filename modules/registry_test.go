@@ -0,0 +1,36 @@
+package modules
+
+import (
+	"testing"
+
+	"github.com/wx13/genesis"
+)
+
+func TestRegistry(t *testing.T) {
+
+	names := genesis.ModuleNames()
+	if len(names) < 16 {
+		t.Error("Modules are missing from the registry:", names)
+	}
+	for _, name := range names {
+		_, err := genesis.NewModule(name, nil)
+		if err != nil {
+			t.Error("Cannot create module:", name, err)
+		}
+	}
+
+	module, err := genesis.NewModule("line_in_file", map[string]interface{}{
+		"file":    "/etc/hosts",
+		"line":    "127.0.1.1 myhost",
+		"pattern": []interface{}{"^127.0.1.1"},
+		"mode":    0644,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lif, ok := module.(LineInFile)
+	if !ok || lif.File != "/etc/hosts" || len(lif.Line) != 1 || lif.Pattern[0] != "^127.0.1.1" || lif.Mode != 0644 {
+		t.Errorf("Wrong module: %+v", module)
+	}
+
+}
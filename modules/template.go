@@ -11,6 +11,7 @@ import (
 	"text/template"
 
 	"github.com/wx13/genesis"
+	"github.com/wx13/genesis/store"
 )
 
 type Template struct {
@@ -19,6 +20,17 @@ type Template struct {
 	Vars interface{}
 }
 
+func init() {
+	genesis.RegisterModule("Template", Template{}, genesis.ModuleDoc{
+		Description: "Writes a file from a Go text/template in the archive.",
+		Fields: map[string]string{
+			"Dest": "Where to write the file.",
+			"Src":  "The template, relative to the archive.",
+			"Vars": "Values for the template.",
+		},
+	})
+}
+
 func (tmpl Template) src() string {
 	match, _ := regexp.MatchString("^[.]?/", tmpl.Src)
 	if match {
@@ -35,11 +47,18 @@ func (tmpl Template) Files() []string {
 	return []string{tmpl.src()}
 }
 
+func (tmpl Template) Targets() []string {
+	return []string{tmpl.Dest}
+}
+
 func (tmpl Template) Remove() (string, error) {
 	err := genesis.Store.RestoreFile(tmpl.Dest, "")
 	if err == nil {
 		return "Successfully restored template file.", nil
 	}
+	if err == store.ErrNoBackup {
+		return "No backup of template file; leaving it in place.", nil
+	}
 	return "Failed to restore template file.", err
 }
 
@@ -12,6 +12,16 @@ type User struct {
 	Name, Passwd string
 }
 
+func init() {
+	genesis.RegisterModule("User", User{}, genesis.ModuleDoc{
+		Description: "Creates a user account.",
+		Fields: map[string]string{
+			"Name":   "Name of the user.",
+			"Passwd": "Password of the user.",
+		},
+	})
+}
+
 func (u User) ID() string {
 	return fmt.Sprintf("User: %s *****", u.Name)
 }
@@ -0,0 +1,354 @@
+package modules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wx13/genesis"
+)
+
+// YAMLFile sets (or deletes) a value in a YAML file.  The value is
+// addressed by a JSON-pointer style path, such as "/server/port".
+// Comments, key order, blank lines and indentation are preserved.  Files
+// with more than one document are not supported.
+type YAMLFile struct {
+	File   string
+	Path   string      // path to the value, e.g. "/server/port" ("/a/-" for an element of list a)
+	Value  interface{} // any value that can be marshaled to YAML
+	Absent bool        // ensure the value is not set
+}
+
+func init() {
+	genesis.RegisterModule("YAMLFile", YAMLFile{}, genesis.ModuleDoc{
+		Description: "Sets (or deletes) a value in a YAML file, preserving comments and key order.",
+		Fields: map[string]string{
+			"File":   "Path to the file.",
+			"Path":   "Path to the value, e.g. \"/server/port\".  A final \"-\" means a list element equal to Value.",
+			"Value":  "The value (any YAML value).",
+			"Absent": "Ensure the value is not set.",
+		},
+	})
+}
+
+func (yf YAMLFile) ID() string {
+	value, _ := yaml.Marshal(yf.Value)
+	return fmt.Sprintf("YAMLFile: file=%s, path=%s, value=%s, absent=%t", yf.File, yf.Path, bytes.TrimSpace(value), yf.Absent)
+}
+
+func (yf YAMLFile) Files() []string {
+	return []string{yf.File}
+}
+
+func (yf YAMLFile) Targets() []string {
+	return []string{yf.File}
+}
+
+func (yf YAMLFile) Status() (genesis.Status, string, error) {
+	yf.File = genesis.ExpandHome(yf.File)
+	content, err := readConfig(yf.File)
+	if err != nil {
+		return genesis.StatusFail, "Could not read file.", err
+	}
+	doc, err := decodeYAML([]byte(content))
+	if err != nil {
+		return genesis.StatusFail, "Could not parse file.", err
+	}
+	keys, element, err := elementPath(splitPointer(yf.Path))
+	if err != nil {
+		return genesis.StatusFail, "Invalid path.", err
+	}
+	want, err := yf.value()
+	if err != nil {
+		return genesis.StatusFail, "Could not encode value.", err
+	}
+	node, _, _ := yamlFind(doc.Content[0], keys)
+	if element {
+		found := len(yamlElements(node, want)) > 0
+		if found == yf.Absent {
+			return genesis.StatusFail, fmt.Sprintf("Element in list: %t.", found), nil
+		}
+		return genesis.StatusPass, fmt.Sprintf("Element in list: %t.", found), nil
+	}
+	if yf.Absent {
+		if node != nil {
+			return genesis.StatusFail, "Value is set.", nil
+		}
+		return genesis.StatusPass, "Value is not set.", nil
+	}
+	if node == nil {
+		return genesis.StatusFail, "Value is not set.", nil
+	}
+	var current interface{}
+	err = node.Decode(&current)
+	if err != nil {
+		return genesis.StatusFail, "Could not decode value.", err
+	}
+	if !reflect.DeepEqual(current, want) {
+		return genesis.StatusFail, fmt.Sprintf("Value is set to %v.", current), nil
+	}
+	return genesis.StatusPass, "Value is set.", nil
+}
+
+func (yf YAMLFile) Install() (string, error) {
+	yf.File = genesis.ExpandHome(yf.File)
+	orig, err := readConfig(yf.File)
+	if err != nil {
+		return "Could not read file.", err
+	}
+	doc, err := decodeYAML([]byte(orig))
+	if err != nil {
+		return "Could not parse file.", err
+	}
+	keys, element, err := elementPath(splitPointer(yf.Path))
+	if err != nil {
+		return "Invalid path.", err
+	}
+	value := &yaml.Node{}
+	err = value.Encode(yf.Value)
+	if err != nil {
+		return "Could not encode value.", err
+	}
+	switch {
+	case element:
+		err = yamlSetElement(doc.Content[0], keys, value, yf.Absent)
+	case yf.Absent:
+		yamlDelete(doc.Content[0], keys)
+	default:
+		err = yamlSet(doc.Content[0], keys, value)
+	}
+	if err != nil {
+		return "Could not set value.", err
+	}
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(yamlIndent(orig))
+	err = enc.Encode(doc)
+	if err != nil {
+		return "Could not encode file.", err
+	}
+	enc.Close()
+	content := yamlBlankLines(orig, buf.String())
+	err = writeConfig(yf.File, orig, content, yf.ID())
+	if err != nil {
+		return "Unable to write file.", err
+	}
+	return "Set value in file.", nil
+}
+
+func (yf YAMLFile) Remove() (string, error) {
+	yf.File = genesis.ExpandHome(yf.File)
+	return removeConfig(yf.File, yf.ID())
+}
+
+// value converts the user's value into the same form as a decoded node.
+func (yf YAMLFile) value() (interface{}, error) {
+	var value interface{}
+	b, err := yaml.Marshal(yf.Value)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(b, &value)
+	return value, err
+}
+
+// decodeYAML parses a document.  An empty document is an empty mapping.
+// More than one document is an error, since the rest would be lost.
+func decodeYAML(data []byte) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(doc)
+	if err == io.EOF {
+		doc = &yaml.Node{}
+	} else if err != nil {
+		return nil, err
+	} else if dec.Decode(&yaml.Node{}) != io.EOF {
+		return nil, errors.New("file has more than one YAML document")
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = &yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	return doc, nil
+}
+
+// yamlIndent finds the indentation of a file (the smallest indentation
+// of any line), so that it can be kept.  The default is 2 spaces.
+func yamlIndent(content string) int {
+	indent := 0
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		n := len(line) - len(trimmed)
+		if n == 0 || len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+		if indent == 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		return 2
+	}
+	return indent
+}
+
+// yamlBlankLines puts back the blank lines of the original file, which
+// the encoder drops.  Each goes before the line that followed it in the
+// original, if that line is still there.
+func yamlBlankLines(orig, content string) string {
+	lines := strings.Split(content, "\n")
+	out := []string{}
+	blanks, next := 0, 0
+	for _, line := range strings.Split(orig, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			blanks++
+			continue
+		}
+		for k := next; blanks > 0 && k < len(lines); k++ {
+			if strings.TrimSpace(lines[k]) == line {
+				out = append(out, lines[next:k]...)
+				out = append(out, make([]string, blanks)...)
+				next = k
+				break
+			}
+		}
+		blanks = 0
+	}
+	out = append(out, lines[next:]...)
+	return strings.Join(out, "\n")
+}
+
+// yamlFind finds the node at the given path.  It also returns the parent
+// node and the index of the node within the parent's content.
+func yamlFind(node *yaml.Node, keys []string) (*yaml.Node, *yaml.Node, int) {
+	var parent *yaml.Node
+	idx := -1
+	for _, key := range keys {
+		parent, idx = node, yamlIndex(node, key)
+		if idx < 0 {
+			return nil, nil, -1
+		}
+		node = node.Content[idx]
+	}
+	return node, parent, idx
+}
+
+// yamlIndex finds the index of a key's value within a mapping or sequence node.
+func yamlIndex(node *yaml.Node, key string) int {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for k := 0; k+1 < len(node.Content); k += 2 {
+			if node.Content[k].Value == key {
+				return k + 1
+			}
+		}
+	case yaml.SequenceNode:
+		k, err := strconv.Atoi(key)
+		if err == nil && k >= 0 && k < len(node.Content) {
+			return k
+		}
+	}
+	return -1
+}
+
+// yamlSet sets the value at the given path, creating mappings as needed.
+// Comments attached to an existing value are kept.
+func yamlSet(node *yaml.Node, keys []string, value *yaml.Node) error {
+	for k, key := range keys {
+		idx := yamlIndex(node, key)
+		last := k == len(keys)-1
+		if idx >= 0 {
+			if last {
+				old := node.Content[idx]
+				value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+				node.Content[idx] = value
+				return nil
+			}
+			node = node.Content[idx]
+			continue
+		}
+		child := value
+		if !last {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("cannot set key %s", key)
+		}
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+		node.Content = append(node.Content, keyNode, child)
+		node = child
+	}
+	return nil
+}
+
+func yamlDelete(node *yaml.Node, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	_, parent, idx := yamlFind(node, keys)
+	if parent == nil {
+		return
+	}
+	if parent.Kind == yaml.MappingNode {
+		parent.Content = append(parent.Content[:idx-1], parent.Content[idx+1:]...)
+	} else {
+		parent.Content = append(parent.Content[:idx], parent.Content[idx+1:]...)
+	}
+}
+
+// yamlElements returns the indices of the elements of a sequence node
+// which decode to value.
+func yamlElements(node *yaml.Node, value interface{}) []int {
+	indices := []int{}
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return indices
+	}
+	for k, elem := range node.Content {
+		var current interface{}
+		if elem.Decode(&current) == nil && reflect.DeepEqual(current, value) {
+			indices = append(indices, k)
+		}
+	}
+	return indices
+}
+
+// yamlSetElement appends value to the sequence at keys, unless the
+// sequence already has an equal element.  With absent, it removes all
+// equal elements instead.
+func yamlSetElement(root *yaml.Node, keys []string, value *yaml.Node, absent bool) error {
+	var want interface{}
+	err := value.Decode(&want)
+	if err != nil {
+		return err
+	}
+	node, _, _ := yamlFind(root, keys)
+	if node != nil && node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("not a list: /%s", strings.Join(keys, "/"))
+	}
+	indices := yamlElements(node, want)
+	if absent {
+		for k := len(indices) - 1; k >= 0; k-- {
+			idx := indices[k]
+			node.Content = append(node.Content[:idx], node.Content[idx+1:]...)
+		}
+		return nil
+	}
+	if len(indices) > 0 {
+		return nil
+	}
+	if node == nil {
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{value}}
+		return yamlSet(root, keys, seq)
+	}
+	node.Content = append(node.Content, value)
+	return nil
+}
@@ -0,0 +1,263 @@
+package genesis
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modules register themselves by name, so that they can be created from
+// a description (e.g. a YAML installer definition) instead of Go code.
+var registry = make(map[string]registeredModule)
+
+type registeredModule struct {
+	name string
+	typ  reflect.Type
+	doc  ModuleDoc
+}
+
+// ModuleDoc documents a module for users of the registry: a description
+// of the module, and of each field (by Go field name).
+type ModuleDoc struct {
+	Description string
+	Fields      map[string]string
+}
+
+// RegisterModule makes a module available by name.  The module must be
+// a struct (not a pointer).  Names are matched without regard to case,
+// underscores or dashes, so "CopyFile" is also "copy_file".
+func RegisterModule(name string, module Module, doc ModuleDoc) {
+	typ := reflect.TypeOf(module)
+	if typ == nil || typ.Kind() != reflect.Struct {
+		panic("genesis: RegisterModule needs a struct module: " + name)
+	}
+	key := NormalizeName(name)
+	if _, dup := registry[key]; dup {
+		panic("genesis: RegisterModule called twice for " + name)
+	}
+	for field := range doc.Fields {
+		if _, ok := typ.FieldByName(field); !ok {
+			panic("genesis: RegisterModule documents unknown field " + name + "." + field)
+		}
+	}
+	registry[key] = registeredModule{name, typ, doc}
+}
+
+// ModuleNames lists the registered modules, sorted.
+func ModuleNames() []string {
+	names := []string{}
+	for _, m := range registry {
+		names = append(names, m.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewModule creates a registered module, setting its fields from a map
+// such as one read from YAML or TOML.  Unknown fields and values of the
+// wrong type are errors.
+func NewModule(name string, fields map[string]interface{}) (Module, error) {
+	m, ok := registry[NormalizeName(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q", name)
+	}
+	value := reflect.New(m.typ).Elem()
+	err := setStruct(value, fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", m.name, err)
+	}
+	return value.Interface().(Module), nil
+}
+
+// NormalizeName folds a field or key name, so that "max_size", "max-size"
+// and "MaxSize" all match.
+func NormalizeName(name string) string {
+	name = strings.Replace(name, "_", "", -1)
+	name = strings.Replace(name, "-", "", -1)
+	return strings.ToLower(name)
+}
+
+// setStruct sets the exported fields of a struct from a map.
+func setStruct(value reflect.Value, fields map[string]interface{}) error {
+
+	typ := value.Type()
+	byName := make(map[string]int)
+	for k := 0; k < typ.NumField(); k++ {
+		if typ.Field(k).PkgPath == "" {
+			byName[NormalizeName(typ.Field(k).Name)] = k
+		}
+	}
+
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		k, ok := byName[NormalizeName(key)]
+		if !ok {
+			return fmt.Errorf("unknown field %q", key)
+		}
+		err := setValue(value.Field(k), fields[key])
+		if err != nil {
+			return fmt.Errorf("field %s: %v", typ.Field(k).Name, err)
+		}
+	}
+	return nil
+
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	fileModeType = reflect.TypeOf(os.FileMode(0))
+)
+
+// setValue sets a value from the generic types that YAML and TOML
+// decode to.  A single value is accepted for a list of one.  Durations
+// are strings such as "30s", and file modes may be octal strings.
+func setValue(value reflect.Value, data interface{}) error {
+
+	if data == nil {
+		return nil
+	}
+	in := reflect.ValueOf(data)
+
+	switch {
+	case value.Kind() == reflect.Interface:
+		if !in.Type().AssignableTo(value.Type()) {
+			return fmt.Errorf("cannot use %v as %s", data, value.Type())
+		}
+		value.Set(in)
+		return nil
+	case value.Type() == durationType:
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("want a duration such as \"30s\", not %v", data)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	case value.Type() == fileModeType:
+		if s, ok := data.(string); ok {
+			mode, err := strconv.ParseUint(s, 8, 32)
+			if err != nil {
+				return fmt.Errorf("want an octal file mode, not %q", s)
+			}
+			value.SetUint(mode)
+			return nil
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		if in.Kind() != reflect.String {
+			return fmt.Errorf("want a string, not %v", data)
+		}
+		value.SetString(in.String())
+	case reflect.Bool:
+		if in.Kind() != reflect.Bool {
+			return fmt.Errorf("want true or false, not %v", data)
+		}
+		value.SetBool(in.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := toInt(in)
+		if !ok {
+			return fmt.Errorf("want a whole number, not %v", data)
+		}
+		if value.Kind() >= reflect.Uint {
+			if n < 0 || value.OverflowUint(uint64(n)) {
+				return fmt.Errorf("%d is out of range", n)
+			}
+			value.SetUint(uint64(n))
+		} else {
+			if value.OverflowInt(n) {
+				return fmt.Errorf("%d is out of range", n)
+			}
+			value.SetInt(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		switch in.Kind() {
+		case reflect.Float32, reflect.Float64:
+			value.SetFloat(in.Float())
+		default:
+			n, ok := toInt(in)
+			if !ok {
+				return fmt.Errorf("want a number, not %v", data)
+			}
+			value.SetFloat(float64(n))
+		}
+	case reflect.Slice:
+		if in.Kind() != reflect.Slice {
+			in = reflect.ValueOf([]interface{}{data})
+		}
+		list := reflect.MakeSlice(value.Type(), in.Len(), in.Len())
+		for k := 0; k < in.Len(); k++ {
+			err := setValue(list.Index(k), in.Index(k).Interface())
+			if err != nil {
+				return fmt.Errorf("item %d: %v", k, err)
+			}
+		}
+		value.Set(list)
+	case reflect.Map:
+		if in.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("want a map, not %v", data)
+		}
+		m := reflect.MakeMap(value.Type())
+		for _, key := range in.MapKeys() {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			err := setValue(elem, in.MapIndex(key).Interface())
+			if err != nil {
+				return fmt.Errorf("key %v: %v", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(fmt.Sprint(key.Interface())), elem)
+		}
+		value.Set(m)
+	case reflect.Struct:
+		fields, ok := ToMap(data)
+		if !ok {
+			return fmt.Errorf("want a map of fields, not %v", data)
+		}
+		return setStruct(value, fields)
+	default:
+		return fmt.Errorf("cannot set a field of type %s", value.Type())
+	}
+	return nil
+
+}
+
+func toInt(in reflect.Value) (int64, bool) {
+	switch in.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return in.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(in.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := in.Float()
+		return int64(f), f == float64(int64(f))
+	}
+	return 0, false
+}
+
+// ToMap converts a map with string keys (from YAML or TOML).
+func ToMap(data interface{}) (map[string]interface{}, bool) {
+	if m, ok := data.(map[string]interface{}); ok {
+		return m, true
+	}
+	in := reflect.ValueOf(data)
+	if in.Kind() != reflect.Map {
+		return nil, false
+	}
+	m := make(map[string]interface{})
+	for _, key := range in.MapKeys() {
+		m[fmt.Sprint(key.Interface())] = in.MapIndex(key).Interface()
+	}
+	return m, true
+}
@@ -0,0 +1,180 @@
+package genesis_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wx13/genesis"
+)
+
+type testModule struct {
+	Path    string
+	Lines   []string
+	Mode    os.FileMode
+	Timeout time.Duration
+	Count   int
+	Force   bool
+	Value   interface{}
+	Nested  []testNested
+	TTLDays []uint
+}
+
+type testNested struct {
+	Name string
+}
+
+func (m testModule) ID() string                              { return "test: " + m.Path }
+func (m testModule) Files() []string                         { return []string{} }
+func (m testModule) Install() (string, error)                { return "", nil }
+func (m testModule) Remove() (string, error)                 { return "", nil }
+func (m testModule) Status() (genesis.Status, string, error) { return genesis.StatusPass, "", nil }
+
+func init() {
+	genesis.RegisterModule("TestModule", testModule{}, genesis.ModuleDoc{
+		Description: "A module for testing.",
+		Fields:      map[string]string{"Path": "Where to test."},
+	})
+}
+
+func TestNewModule(t *testing.T) {
+
+	module, err := genesis.NewModule("test_module", map[string]interface{}{
+		"path":    "/tmp/x",
+		"lines":   "one line",
+		"mode":    "0640",
+		"timeout": "30s",
+		"count":   int64(3),
+		"Force":   true,
+		"value":   map[string]interface{}{"a": 1},
+		"nested":  []map[string]interface{}{{"name": "n1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testModule{
+		Path:    "/tmp/x",
+		Lines:   []string{"one line"},
+		Mode:    0640,
+		Timeout: 30 * time.Second,
+		Count:   3,
+		Force:   true,
+		Value:   map[string]interface{}{"a": 1},
+		Nested:  []testNested{{"n1"}},
+	}
+	if !reflect.DeepEqual(module, expected) {
+		t.Errorf("Wrong module:\n%+v\n%+v", module, expected)
+	}
+
+}
+
+func TestNewModuleErrors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		err    string
+	}{
+		{"nothing", nil, "unknown module"},
+		{"TestModule", map[string]interface{}{"paths": "x"}, "unknown field"},
+		{"TestModule", map[string]interface{}{"path": 5}, "want a string"},
+		{"TestModule", map[string]interface{}{"count": "3"}, "want a whole number"},
+		{"TestModule", map[string]interface{}{"count": 2.5}, "want a whole number"},
+		{"TestModule", map[string]interface{}{"timeout": 30}, "want a duration"},
+		{"TestModule", map[string]interface{}{"mode": "rw"}, "octal"},
+		{"TestModule", map[string]interface{}{"nested": []interface{}{"x"}}, "want a map"},
+		{"TestModule", map[string]interface{}{"nested": []interface{}{map[string]interface{}{"nam": "x"}}}, "unknown field"},
+	}
+	for _, test := range tests {
+		_, err := genesis.NewModule(test.name, test.fields)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: expected error %q, got %v", test.fields, test.err, err)
+		}
+	}
+
+}
+
+func TestModuleNames(t *testing.T) {
+
+	found := false
+	for _, name := range genesis.ModuleNames() {
+		if name == "TestModule" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("TestModule is not registered:", genesis.ModuleNames())
+	}
+
+}
+
+func TestDescribeModule(t *testing.T) {
+
+	info, ok := genesis.DescribeModule("test-module")
+	if !ok {
+		t.Fatal("TestModule is not described")
+	}
+	if info.Name != "TestModule" || info.Key != "test_module" || info.Description != "A module for testing." {
+		t.Errorf("Wrong module info: %+v", info)
+	}
+
+	expected := []genesis.ModuleField{
+		{"Path", "path", "string", "Where to test."},
+		{"Lines", "lines", "list of string", ""},
+		{"Mode", "mode", "file mode", ""},
+		{"Timeout", "timeout", "duration", ""},
+		{"Count", "count", "integer", ""},
+		{"Force", "force", "bool", ""},
+		{"Value", "value", "any", ""},
+		{"Nested", "nested", "list of testNested", ""},
+		{"TTLDays", "ttl_days", "list of integer", ""},
+	}
+	if !reflect.DeepEqual(info.Fields, expected) {
+		t.Errorf("Wrong fields:\n%+v\n%+v", info.Fields, expected)
+	}
+
+	_, ok = genesis.DescribeModule("nothing")
+	if ok {
+		t.Error("Described an unknown module.")
+	}
+
+}
+
+func TestModuleSchema(t *testing.T) {
+
+	schema, ok := genesis.ModuleSchema("TestModule")
+	if !ok {
+		t.Fatal("No schema for TestModule")
+	}
+	if schema["title"] != "TestModule" || schema["description"] != "A module for testing." {
+		t.Errorf("Wrong title or description: %v", schema)
+	}
+	if schema["additionalProperties"] != false {
+		t.Error("Schema allows unknown fields.")
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	if len(properties) != 9 {
+		t.Errorf("Expected 9 properties, got %d: %v", len(properties), properties)
+	}
+	path := properties["path"].(map[string]interface{})
+	if path["type"] != "string" || path["description"] != "Where to test." {
+		t.Errorf("Wrong schema for path: %v", path)
+	}
+	force := properties["force"].(map[string]interface{})
+	if force["type"] != "boolean" {
+		t.Errorf("Wrong schema for force: %v", force)
+	}
+	if _, ok := properties["ttl_days"]; !ok {
+		t.Error("No schema for ttl_days")
+	}
+
+	nested := properties["nested"].(map[string]interface{})["anyOf"].([]interface{})
+	item := nested[0].(map[string]interface{})
+	if _, ok := item["properties"].(map[string]interface{})["name"]; !ok {
+		t.Errorf("Wrong schema for nested: %v", nested)
+	}
+
+}
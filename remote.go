@@ -0,0 +1,71 @@
+package genesis
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// IsRemote checks if a file (as reported by a module's Files method)
+// is a remote resource rather than a local file.
+func IsRemote(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// RemoteFile formats a url and an optional sha256 checksum, so that
+// a module can report a remote resource in its Files method.
+func RemoteFile(url, checksum string) string {
+	if len(checksum) == 0 {
+		return url
+	}
+	return url + "#sha256=" + checksum
+}
+
+// SplitRemote is the inverse of RemoteFile.
+func SplitRemote(file string) (string, string) {
+	k := strings.LastIndex(file, "#sha256=")
+	if k < 0 {
+		return file, ""
+	}
+	return file[:k], file[k+len("#sha256="):]
+}
+
+// RemotePath is the location of a remote resource within the
+// installer archive (relative to Tmpdir).
+func RemotePath(url string) string {
+	return filepath.Join("remote", fmt.Sprintf("%x", md5.Sum([]byte(url))))
+}
+
+// VerifyChecksum checks data against a hex-encoded sha256 checksum.
+// An empty checksum always passes.
+func VerifyChecksum(data []byte, checksum string) error {
+	if len(checksum) == 0 {
+		return nil
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if sum != strings.ToLower(checksum) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, sum)
+	}
+	return nil
+}
+
+// Fetch downloads a remote resource and verifies its checksum.
+func Fetch(url, checksum string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response from %s: %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return body, VerifyChecksum(body, checksum)
+}
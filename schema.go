@@ -0,0 +1,171 @@
+package genesis
+
+import (
+	"reflect"
+	"unicode"
+)
+
+// ModuleInfo describes a registered module, and its fields.
+type ModuleInfo struct {
+	Name        string // e.g. "LineInFile"
+	Key         string // the name in definition files, e.g. "line_in_file"
+	Description string
+	Fields      []ModuleField
+}
+
+// ModuleField describes a field of a registered module.
+type ModuleField struct {
+	Name        string // e.g. "ReplaceAll"
+	Key         string // the name in definition files, e.g. "replace_all"
+	Type        string // e.g. "list of string", "duration"
+	Description string
+}
+
+// DescribeModule looks up the documentation of a registered module.
+func DescribeModule(name string) (ModuleInfo, bool) {
+	m, ok := registry[NormalizeName(name)]
+	if !ok {
+		return ModuleInfo{}, false
+	}
+	info := ModuleInfo{
+		Name:        m.name,
+		Key:         snakeName(m.name),
+		Description: m.doc.Description,
+		Fields:      []ModuleField{},
+	}
+	for _, field := range exportedFields(m.typ) {
+		info.Fields = append(info.Fields, ModuleField{
+			Name:        field.Name,
+			Key:         snakeName(field.Name),
+			Type:        typeName(field.Type),
+			Description: m.doc.Fields[field.Name],
+		})
+	}
+	return info, true
+}
+
+// ModuleSchema makes a JSON schema for a registered module's fields, as
+// written in a definition file.  It can be used by editors to complete
+// and check definitions.
+func ModuleSchema(name string) (map[string]interface{}, bool) {
+	m, ok := registry[NormalizeName(name)]
+	if !ok {
+		return nil, false
+	}
+	schema := structSchema(m.typ, m.doc)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = m.name
+	if len(m.doc.Description) > 0 {
+		schema["description"] = m.doc.Description
+	}
+	return schema, true
+}
+
+func exportedFields(typ reflect.Type) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for k := 0; k < typ.NumField(); k++ {
+		if typ.Field(k).PkgPath == "" {
+			fields = append(fields, typ.Field(k))
+		}
+	}
+	return fields
+}
+
+func structSchema(typ reflect.Type, doc ModuleDoc) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, field := range exportedFields(typ) {
+		schema := typeSchema(field.Type)
+		if desc := doc.Fields[field.Name]; len(desc) > 0 {
+			schema["description"] = desc
+		}
+		properties[snakeName(field.Name)] = schema
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema is the JSON schema for a value which setValue accepts.
+func typeSchema(typ reflect.Type) map[string]interface{} {
+
+	switch typ {
+	case durationType:
+		return map[string]interface{}{"type": "string", "pattern": `^([0-9.]+(ns|us|µs|ms|s|m|h))+$`}
+	case fileModeType:
+		return map[string]interface{}{"type": []string{"integer", "string"}, "pattern": "^[0-7]+$"}
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		// A single value is accepted for a list of one.
+		item := typeSchema(typ.Elem())
+		return map[string]interface{}{"anyOf": []interface{}{
+			item,
+			map[string]interface{}{"type": "array", "items": item},
+		}}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(typ.Elem())}
+	case reflect.Struct:
+		doc := ModuleDoc{}
+		for _, m := range registry {
+			if m.typ == typ {
+				doc = m.doc
+			}
+		}
+		return structSchema(typ, doc)
+	}
+	return map[string]interface{}{} // anything
+}
+
+// typeName describes a field's type for people.
+func typeName(typ reflect.Type) string {
+	switch typ {
+	case durationType:
+		return "duration"
+	case fileModeType:
+		return "file mode"
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Interface:
+		return "any"
+	case reflect.Slice:
+		return "list of " + typeName(typ.Elem())
+	case reflect.Map:
+		return "map of " + typeName(typ.Elem())
+	}
+	return typ.Name()
+}
+
+// snakeName converts a Go name to the style of definition files,
+// e.g. "ReplaceAll" to "replace_all" and "JSONFile" to "json_file".
+func snakeName(name string) string {
+	runes := []rune(name)
+	out := []rune{}
+	for k, r := range runes {
+		if k > 0 && unicode.IsUpper(r) {
+			prev := runes[k-1]
+			nextLower := k+1 < len(runes) && unicode.IsLower(runes[k+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
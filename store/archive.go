@@ -0,0 +1,161 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArchiveBackend keeps all items in a single zip file, which is easy
+// to copy off a device.  The archive is read into memory when opened.
+// Changes are kept in memory until Flush (or Close) rewrites the archive.
+type ArchiveBackend struct {
+	File    string
+	mem     *MemoryBackend
+	changed map[string]archiveItem // items as they were before any unsaved changes
+}
+
+// archiveItem is the saved state of an item.
+type archiveItem struct {
+	data   []byte
+	exists bool
+}
+
+// OpenArchiveBackend reads an archive (if it exists).
+func OpenArchiveBackend(file string) (*ArchiveBackend, error) {
+	archive := ArchiveBackend{
+		File:    file,
+		mem:     NewMemoryBackend(),
+		changed: make(map[string]archiveItem),
+	}
+	zipRdr, err := zip.OpenReader(file)
+	if os.IsNotExist(err) {
+		return &archive, nil
+	}
+	if err != nil {
+		return &archive, err
+	}
+	defer zipRdr.Close()
+	for _, f := range zipRdr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return &archive, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return &archive, err
+		}
+		archive.mem.items[f.Name] = data
+	}
+	return &archive, nil
+}
+
+func (archive *ArchiveBackend) Read(name string) ([]byte, error) {
+	return archive.mem.Read(name)
+}
+
+func (archive *ArchiveBackend) Exists(name string) bool {
+	return archive.mem.Exists(name)
+}
+
+func (archive *ArchiveBackend) Write(name string, data []byte) error {
+	archive.remember(name)
+	return archive.mem.Write(name, data)
+}
+
+func (archive *ArchiveBackend) Remove(name string) error {
+	archive.remember(name)
+	return archive.mem.Remove(name)
+}
+
+// remember records the saved state of an item before it is changed.
+func (archive *ArchiveBackend) remember(name string) {
+	archive.mem.mutex.Lock()
+	defer archive.mem.mutex.Unlock()
+	if _, ok := archive.changed[name]; ok {
+		return
+	}
+	data, ok := archive.mem.items[name]
+	archive.changed[name] = archiveItem{data: data, exists: ok}
+}
+
+// Flush writes out the archive, if anything has changed.  If that
+// fails, the unsaved changes are dropped, so that the backend still
+// matches the archive on disk.
+func (archive *ArchiveBackend) Flush() error {
+
+	archive.mem.mutex.Lock()
+	defer archive.mem.mutex.Unlock()
+
+	if len(archive.changed) == 0 {
+		return nil
+	}
+	err := archive.save()
+	if err != nil {
+		for name, item := range archive.changed {
+			if item.exists {
+				archive.mem.items[name] = item.data
+			} else {
+				delete(archive.mem.items, name)
+			}
+		}
+	}
+	archive.changed = make(map[string]archiveItem)
+	return err
+
+}
+
+// Close flushes the archive.
+func (archive *ArchiveBackend) Close() error {
+	return archive.Flush()
+}
+
+// save writes out the whole archive, replacing the old one atomically.
+// Blobs are already gzipped, so they are stored without compression.
+// The caller must hold the lock.
+func (archive *ArchiveBackend) save() error {
+
+	names := []string{}
+	for name := range archive.mem.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range names {
+		header := &zip.FileHeader{Name: filepath.ToSlash(name), Method: zip.Deflate}
+		if strings.HasSuffix(name, ".gz") {
+			header.Method = zip.Store
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(archive.mem.items[name])
+		if err != nil {
+			return err
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(archive.File), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := archive.File + ".tmp"
+	err = ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, archive.File)
+
+}
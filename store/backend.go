@@ -0,0 +1,89 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Backend persists the items of a Store (the catalog and the blobs).
+// Items are named with slash-separated relative paths.  Reading a
+// missing item returns an error for which os.IsNotExist is true.
+type Backend interface {
+	Read(name string) ([]byte, error)
+	Write(name string, data []byte) error
+	Remove(name string) error
+	Exists(name string) bool
+}
+
+// DirBackend keeps items as files within a directory.  This is the default.
+type DirBackend struct {
+	Dir string
+}
+
+func (dir DirBackend) Read(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(dir.Dir, name))
+}
+
+func (dir DirBackend) Write(name string, data []byte) error {
+	path := filepath.Join(dir.Dir, name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func (dir DirBackend) Remove(name string) error {
+	return os.Remove(filepath.Join(dir.Dir, name))
+}
+
+func (dir DirBackend) Exists(name string) bool {
+	_, err := os.Stat(filepath.Join(dir.Dir, name))
+	return err == nil
+}
+
+// MemoryBackend keeps items in memory.  It is useful for testing.
+type MemoryBackend struct {
+	mutex sync.Mutex
+	items map[string][]byte
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{items: make(map[string][]byte)}
+}
+
+func (mem *MemoryBackend) Read(name string) ([]byte, error) {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	data, ok := mem.items[name]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte{}, data...), nil
+}
+
+func (mem *MemoryBackend) Write(name string, data []byte) error {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	mem.items[name] = append([]byte{}, data...)
+	return nil
+}
+
+func (mem *MemoryBackend) Remove(name string) error {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if _, ok := mem.items[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(mem.items, name)
+	return nil
+}
+
+func (mem *MemoryBackend) Exists(name string) bool {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	_, ok := mem.items[name]
+	return ok
+}
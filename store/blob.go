@@ -0,0 +1,95 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Backups and patches are stored as blobs, addressed by the sha256
+// of their (uncompressed) content, so identical files are only stored
+// once no matter how many labels or generations refer to them.
+
+func blobName(hash string) string {
+	return filepath.Join("blobs", hash[:2], hash+".gz")
+}
+
+// putBlob compresses and stores data, and returns its hash.
+func (store *Store) putBlob(data []byte) (string, error) {
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	name := blobName(hash)
+	if store.exists(name) {
+		return hash, nil
+	}
+	buf := new(bytes.Buffer)
+	w, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	_, err := w.Write(data)
+	if err != nil {
+		return "", err
+	}
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+	return hash, store.write(name, buf.Bytes())
+}
+
+// getBlob reads and decompresses a blob.
+func (store *Store) getBlob(hash string) ([]byte, error) {
+	if len(hash) < 2 {
+		return nil, fmt.Errorf("invalid blob hash: %q", hash)
+	}
+	data, err := store.read(blobName(hash))
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// pruneBlobs removes blobs which are no longer referenced by any entry.
+func (store *Store) pruneBlobs(hashes ...string) error {
+	entries, err := store.Entries()
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		used[entry.Patch] = true
+		used[entry.Applied] = true
+		for _, gen := range entry.Generations {
+			used[gen.Blob] = true
+		}
+	}
+	for _, hash := range hashes {
+		if len(hash) > 0 && !used[hash] {
+			store.remove(blobName(hash))
+		}
+	}
+	return nil
+}
+
+// read, write, exists and remove access items in the store by name.
+
+func (store *Store) read(name string) ([]byte, error) {
+	return store.Backend.Read(filepath.ToSlash(name))
+}
+
+func (store *Store) write(name string, data []byte) error {
+	return store.Backend.Write(filepath.ToSlash(name), data)
+}
+
+func (store *Store) exists(name string) bool {
+	return store.Backend.Exists(filepath.ToSlash(name))
+}
+
+func (store *Store) remove(name string) error {
+	return store.Backend.Remove(filepath.ToSlash(name))
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// TaskRef identifies a task which created a store entry.
+type TaskRef struct {
+	Tag  string // hash tag of the task
+	Desc string // first line of the task ID
+}
+
+// Entry describes one item in the store: the backups of a file, or a patch.
+// The catalog of entries is the index into the blob storage.
+type Entry struct {
+	Path        string // original file path
+	Label       string
+	Kind        string // "file" or "patch"
+	Tasks       []TaskRef
+	Generations []Generation `json:",omitempty"` // for files
+	Patch       string       `json:",omitempty"` // blob hash, for patches
+	Applied     string       `json:",omitempty"` // blob hash of the patched file, for patches
+}
+
+const catalogName = "catalog.json"
+
+// Entries lists everything in the store.  Backups made by older versions
+// of genesis are not in the catalog until they are next used.
+func (store *Store) Entries() ([]Entry, error) {
+	entries := []Entry{}
+	data, err := store.read(catalogName)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+func (store *Store) saveEntries(entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.write(catalogName, data)
+}
+
+func findEntry(entries []Entry, filename, label, kind string) int {
+	for k, entry := range entries {
+		if entry.Path == filename && entry.Label == label && entry.Kind == kind {
+			return k
+		}
+	}
+	return -1
+}
+
+// entry finds (or creates) an entry in the catalog.  The index of
+// the entry is returned along with the full list.
+func (store *Store) entry(filename, label, kind string) ([]Entry, int, error) {
+	entries, err := store.Entries()
+	if err != nil {
+		return entries, -1, err
+	}
+	k := findEntry(entries, filename, label, kind)
+	if k < 0 {
+		entries = append(entries, Entry{Path: filename, Label: label, Kind: kind})
+		k = len(entries) - 1
+	}
+	return entries, k, nil
+}
+
+// addTask records the current task with an entry.
+func (store *Store) addTask(entry *Entry) {
+	if len(store.Task.Tag) == 0 {
+		return
+	}
+	for _, task := range entry.Tasks {
+		if task.Tag == store.Task.Tag {
+			return
+		}
+	}
+	entry.Tasks = append(entry.Tasks, store.Task)
+}
+
+// RemoveEntry deletes an item (and all its backups) from the store.
+func (store *Store) RemoveEntry(entry Entry) error {
+	entries, err := store.Entries()
+	if err != nil {
+		return err
+	}
+	k := findEntry(entries, entry.Path, entry.Label, entry.Kind)
+	if k < 0 {
+		return nil
+	}
+	entry = entries[k]
+	entries = append(entries[:k], entries[k+1:]...)
+	err = store.saveEntries(entries)
+	if err != nil {
+		return err
+	}
+	hashes := []string{entry.Patch, entry.Applied}
+	for _, gen := range entry.Generations {
+		hashes = append(hashes, gen.Blob)
+	}
+	return store.pruneBlobs(hashes...)
+}
+
+// ReadGeneration reads the contents of a file backup.
+func (store *Store) ReadGeneration(filename, label string, n int) ([]byte, error) {
+	gens, err := store.Generations(filename, label)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > len(gens) {
+		return nil, ErrNoBackup
+	}
+	return store.getBlob(gens[n-1].Blob)
+}
+
+// Diff computes a line-by-line diff between two strings, with
+// removed lines prefixed by "-" and added lines by "+".
+func Diff(a, b string) string {
+	dmp := diffmatchpatch.New()
+	ca, cb, lines := dmp.DiffLinesToChars(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(ca, cb, false), lines)
+	out := []string{}
+	for _, diff := range diffs {
+		prefix := " "
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		}
+		for _, line := range strings.SplitAfter(diff.Text, "\n") {
+			if len(line) > 0 {
+				out = append(out, prefix+strings.TrimSuffix(line, "\n"))
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
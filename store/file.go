@@ -2,73 +2,204 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"strconv"
+	"time"
 )
 
-// RestoreFile restores a file from backup.
+// Generation is a snapshot of a file, taken before genesis changed it.
+// Generation 1 is the original (pre-genesis) file.
+type Generation struct {
+	N     int
+	Time  time.Time
+	RunID string
+	Blob  string `json:",omitempty"` // hash of the file contents
+	Metadata
+}
+
+// RestoreFile restores a file from backup.  Which backup is restored
+// depends on store.Restore: "original" (the default), "previous"
+// (undo the most recent change), or a generation number.
 func (store *Store) RestoreFile(filename, label string) error {
 
 	if store == nil {
 		return errors.New("no store")
 	}
 
-	src := store.createPath(filename, label)
+	gens, err := store.Generations(filename, label)
+	if err != nil {
+		return err
+	}
+
+	// No backup is not the same as "the file didn't exist", so
+	// leave the file alone.
+	if len(gens) == 0 {
+		return ErrNoBackup
+	}
+
+	n, err := store.target(gens)
+	if err != nil {
+		return err
+	}
+	gen := gens[n-1]
 
-	// If the backup file doesn't exist, then we remove the original.
-	_, err := os.Stat(src)
+	var bytes []byte
+	if len(gen.Blob) > 0 {
+		bytes, err = store.getBlob(gen.Blob)
+		if err != nil {
+			return err
+		}
+	}
+	err = gen.restore(filename, bytes, store)
 	if err != nil {
-		os.Remove(filename)
+		return err
 	}
 
-	// If we can't read the backup file, then there is
-	// nothing to revert.
-	bytes, err := ioutil.ReadFile(src)
+	// Restoring generation n rewinds history to before change n.
+	// The original is always kept.
+	if n == 1 {
+		n = 2
+	}
+	entries, k, err := store.entry(filename, label, "file")
 	if err != nil {
-		return nil
+		return err
 	}
+	entries[k].Generations = gens[:n-1]
+	err = store.saveEntries(entries)
+	if err != nil {
+		return err
+	}
+	hashes := []string{}
+	for _, g := range gens[n-1:] {
+		hashes = append(hashes, g.Blob)
+	}
+	return store.pruneBlobs(hashes...)
 
-	// Write file.
-	return store.WriteFile(filename, bytes)
+}
 
+// target picks the generation to restore.
+func (store *Store) target(gens []Generation) (int, error) {
+	switch store.Restore {
+	case "", "original":
+		return 1, nil
+	case "previous":
+		return len(gens), nil
+	}
+	n, err := strconv.Atoi(store.Restore)
+	if err != nil || n < 1 || n > len(gens) {
+		return 0, fmt.Errorf("no such generation: %s", store.Restore)
+	}
+	return n, nil
 }
 
-// SaveFile makes a backup of a file.
+// SaveFile makes a backup of a file.  Every call records a new
+// generation, except that only one generation is recorded per run.
 func (store *Store) SaveFile(filename, label string) error {
 
 	if store == nil {
 		return errors.New("no store")
 	}
 
-	// If we can't read the source file, then we can't back it up.
-	bytes, err := ioutil.ReadFile(filename)
+	// Make sure any old-style backups are in the catalog.
+	_, err := store.Generations(filename, label)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	dest := store.createPath(filename, label)
-
-	// Create the destination directory.
-	dir := filepath.Dir(dest)
-	err = os.MkdirAll(dir, 0755)
+	entries, k, err := store.entry(filename, label, "file")
 	if err != nil {
 		return err
 	}
+	entry := &entries[k]
+	store.addTask(entry)
+	gens := entry.Generations
+	if len(gens) > 0 && gens[len(gens)-1].RunID == store.RunID {
+		return store.saveEntries(entries)
+	}
 
-	// Write to the backup file, but only if it doesn't exist already.
-	info, _ := os.Stat(filename)
-	mode := info.Mode()
-	f, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+	meta, err := readMetadata(filename)
 	if err != nil {
-		if os.IsExist(err) {
-			return nil
-		}
 		return err
 	}
-	defer f.Close()
-	_, err = f.Write(bytes)
+	gen := Generation{
+		N:        len(gens) + 1,
+		Time:     time.Now(),
+		RunID:    store.RunID,
+		Metadata: meta,
+	}
 
-	return err
+	// Symlinks and missing files are described fully by the metadata.
+	if !meta.Missing && len(meta.Link) == 0 {
+		bytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		gen.Blob, err = store.putBlob(bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	entry.Generations = append(gens, gen)
+	return store.saveEntries(entries)
+
+}
+
+// Generations lists the backups of a file, oldest first.  Backups
+// from older versions of genesis are moved into the catalog.
+func (store *Store) Generations(filename, label string) ([]Generation, error) {
+
+	entries, err := store.Entries()
+	if err != nil {
+		return nil, err
+	}
+	k := findEntry(entries, filename, label, "file")
+	if k >= 0 && len(entries[k].Generations) > 0 {
+		return entries[k].Generations, nil
+	}
+
+	gens, err := store.legacyGenerations(filename, label)
+	if err != nil || len(gens) == 0 {
+		return gens, err
+	}
+	entries, k, err = store.entry(filename, label, "file")
+	if err != nil {
+		return nil, err
+	}
+	entries[k].Generations = gens
+	err = store.saveEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(store.createPath(filename, label))
+	return gens, nil
+
+}
+
+// legacyGenerations reads a backup made by older versions of genesis,
+// which kept a single original file at createPath.  The contents are
+// moved into a blob.
+func (store *Store) legacyGenerations(filename, label string) ([]Generation, error) {
+
+	if len(store.Dir) == 0 {
+		return []Generation{}, nil
+	}
+	path := store.createPath(filename, label)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return []Generation{}, nil
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	gen := Generation{N: 1, Time: info.ModTime(), RunID: "legacy"}
+	gen.Blob, err = store.putBlob(bytes)
+	if err != nil {
+		return nil, err
+	}
+	return []Generation{gen}, nil
 
 }
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Merge3 does a line-based three-way merge.  Base is the common ancestor
+// of current and other.  Changes made on either side are combined; where
+// both sides changed the same lines differently, the merged text contains
+// conflict markers.  The number of conflicts is returned.
+func Merge3(current, base, other string) (string, int) {
+
+	a, b, o := splitLines(current), splitLines(base), splitLines(other)
+	matchA := matchLines(b, a)
+	matchO := matchLines(b, o)
+
+	merged := []string{}
+	conflicts := 0
+	ia, ib, io := 0, 0, 0
+	for ia < len(a) || ib < len(b) || io < len(o) {
+
+		// Lines which are unchanged on both sides.
+		j := 0
+		for ib+j < len(b) && matchA[ib+j] == ia+j && matchO[ib+j] == io+j {
+			j++
+		}
+		if j > 0 {
+			merged = append(merged, b[ib:ib+j]...)
+			ia, ib, io = ia+j, ib+j, io+j
+			continue
+		}
+
+		// Find the next base line kept by both sides; everything
+		// before it was changed by at least one side.
+		k := ib
+		for k < len(b) && (matchA[k] < 0 || matchO[k] < 0) {
+			k++
+		}
+		ka, ko := len(a), len(o)
+		if k < len(b) {
+			ka, ko = matchA[k], matchO[k]
+		}
+		chunkA, chunkB, chunkO := a[ia:ka], b[ib:k], o[io:ko]
+		lines, ok := mergeLineByLine(chunkA, chunkB, chunkO)
+		switch {
+		case equalLines(chunkA, chunkB):
+			merged = append(merged, chunkO...)
+		case equalLines(chunkO, chunkB), equalLines(chunkA, chunkO):
+			merged = append(merged, chunkA...)
+		case ok:
+			merged = append(merged, lines...)
+		default:
+			conflicts++
+			merged = append(merged, "<<<<<<< current\n")
+			merged = append(merged, terminate(chunkA)...)
+			merged = append(merged, "||||||| genesis\n")
+			merged = append(merged, terminate(chunkB)...)
+			merged = append(merged, "=======\n")
+			merged = append(merged, terminate(chunkO)...)
+			merged = append(merged, ">>>>>>> original\n")
+		}
+		ia, ib, io = ka, k, ko
+
+	}
+
+	return strings.Join(merged, ""), conflicts
+
+}
+
+// splitLines splits text into lines, keeping the line endings.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines maps each line of base to the matching line of other,
+// or to -1 if the line is not in other.
+func matchLines(base, other []string) []int {
+
+	// Encode each distinct line as a rune, and diff the runes.
+	codes := make(map[string]rune)
+	encode := func(lines []string) []rune {
+		runes := make([]rune, len(lines))
+		for k, line := range lines {
+			code, ok := codes[line]
+			if !ok {
+				code = rune(len(codes) + 1)
+				if code >= 0xD800 {
+					code += 0x800 // skip the surrogates
+				}
+				codes[line] = code
+			}
+			runes[k] = code
+		}
+		return runes
+	}
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMainRunes(encode(base), encode(other), false)
+
+	match := make([]int, len(base))
+	ib, io := 0, 0
+	for _, diff := range diffs {
+		n := len([]rune(diff.Text))
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			for k := 0; k < n; k++ {
+				match[ib+k] = io + k
+			}
+			ib, io = ib+n, io+n
+		case diffmatchpatch.DiffDelete:
+			for k := 0; k < n; k++ {
+				match[ib+k] = -1
+			}
+			ib += n
+		case diffmatchpatch.DiffInsert:
+			io += n
+		}
+	}
+	return match
+
+}
+
+// mergeLineByLine merges chunks in which lines were replaced one for
+// one (e.g. adjacent settings in a config file), as long as no line was
+// changed on both sides.
+func mergeLineByLine(a, b, o []string) ([]string, bool) {
+	if len(a) != len(b) || len(o) != len(b) {
+		return nil, false
+	}
+	lines := make([]string, len(b))
+	for k := range b {
+		switch {
+		case a[k] == b[k]:
+			lines[k] = o[k]
+		case o[k] == b[k], a[k] == o[k]:
+			lines[k] = a[k]
+		default:
+			return nil, false
+		}
+	}
+	return lines, true
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// terminate makes sure the last line ends in a newline, so that
+// conflict markers start on their own line.
+func terminate(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	out := append([]string{}, lines...)
+	out[len(out)-1] += "\n"
+	return out
+}
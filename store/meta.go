@@ -0,0 +1,95 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrNoBackup is returned when restoring a file that was never backed up.
+var ErrNoBackup = errors.New("no backup of file")
+
+// Metadata describes a file at the time it was backed up.
+type Metadata struct {
+	Missing     bool // the file did not exist
+	HasMetadata bool // false for backups made by older versions of genesis
+	Mode        os.FileMode
+	Uid         int
+	Gid         int
+	ModTime     time.Time
+	Link        string            `json:",omitempty"` // symlink target
+	Xattrs      map[string][]byte `json:",omitempty"` // extended attributes
+}
+
+// readMetadata gathers the metadata of a file (without following symlinks).
+func readMetadata(filename string) (Metadata, error) {
+	info, err := os.Lstat(filename)
+	if os.IsNotExist(err) {
+		return Metadata{Missing: true, HasMetadata: true}, nil
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+	if info.IsDir() {
+		return Metadata{}, errors.New("cannot back up a directory: " + filename)
+	}
+	meta := Metadata{
+		HasMetadata: true,
+		Mode:        info.Mode(),
+		ModTime:     info.ModTime(),
+	}
+	meta.Uid, meta.Gid = fileOwner(info)
+	if info.Mode()&os.ModeSymlink != 0 {
+		meta.Link, err = os.Readlink(filename)
+		return meta, err
+	}
+	meta.Xattrs, err = getXattrs(filename)
+	return meta, err
+}
+
+// restore writes a file's contents (or symlink), then applies the metadata.
+func (meta Metadata) restore(filename string, data []byte, store *Store) error {
+
+	if meta.Missing {
+		err := os.Remove(filename)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Don't write through a symlink, and don't turn a file into a symlink
+	// by writing to it.
+	info, err := os.Lstat(filename)
+	if err == nil && (info.Mode()&os.ModeSymlink != 0 || len(meta.Link) > 0) {
+		os.Remove(filename)
+	}
+
+	if len(meta.Link) > 0 {
+		err = os.Symlink(meta.Link, filename)
+		if err != nil {
+			return err
+		}
+		return lchown(filename, meta.Uid, meta.Gid)
+	}
+
+	err = store.WriteFile(filename, data)
+	if err != nil || !meta.HasMetadata {
+		return err
+	}
+
+	err = os.Chmod(filename, meta.Mode)
+	if err != nil {
+		return err
+	}
+	err = lchown(filename, meta.Uid, meta.Gid)
+	if err != nil {
+		return err
+	}
+	err = setXattrs(filename, meta.Xattrs)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(filename, meta.ModTime, meta.ModTime)
+
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+)
+
+func fileOwner(info os.FileInfo) (int, int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
+
+// lchown changes ownership, unless it is already correct (which
+// lets non-root users restore their own files).
+func lchown(filename string, uid, gid int) error {
+	info, err := os.Lstat(filename)
+	if err != nil {
+		return err
+	}
+	u, g := fileOwner(info)
+	if u == uid && g == gid {
+		return nil
+	}
+	return os.Lchown(filename, uid, gid)
+}
+
+func getXattrs(filename string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(filename, nil)
+	if err != nil || size == 0 {
+		// Not all filesystems support extended attributes.
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(filename, buf)
+	if err != nil {
+		return nil, nil
+	}
+	xattrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := syscall.Getxattr(filename, string(name), nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		n, err = syscall.Getxattr(filename, string(name), value)
+		if err != nil {
+			continue
+		}
+		xattrs[string(name)] = value[:n]
+	}
+	return xattrs, nil
+}
+
+func setXattrs(filename string, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		err := syscall.Setxattr(filename, name, value, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package store
+
+import (
+	"os"
+)
+
+// Ownership and extended attributes are only supported on linux.
+
+func fileOwner(info os.FileInfo) (int, int) {
+	return -1, -1
+}
+
+func lchown(filename string, uid, gid int) error {
+	return nil
+}
+
+func getXattrs(filename string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattrs(filename string, xattrs map[string][]byte) error {
+	return nil
+}
@@ -2,14 +2,20 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-// ApplyPatch applies a patch to a file.
+// ApplyPatch reverses the changes recorded by SavePatch.  If the file
+// was edited after it was patched, the edits are kept by a three-way
+// merge.  If they conflict with the patch, the file is left alone, the
+// merge (with conflict markers) is written next to it, and an error
+// is returned.  A patch is never partially applied.
 func (store *Store) ApplyPatch(filename, label string) error {
 
 	if store == nil {
@@ -17,31 +23,92 @@ func (store *Store) ApplyPatch(filename, label string) error {
 	}
 
 	// Read file.
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	fileStr := string(b)
 
-	// Read patch file.
-	patchFile := store.createPath(filename, label)
-	b, err = ioutil.ReadFile(patchFile)
+	unpatched, conflicts, err := store.Unpatch(filename, label, string(b))
+	if err != nil {
+		return err
+	}
+	if conflicts == 0 {
+		return store.WriteFile(filename, []byte(unpatched))
+	}
+	mergeFile := filename + ".genesis-merge"
+	err = ioutil.WriteFile(mergeFile, []byte(unpatched), info.Mode().Perm())
 	if err != nil {
 		return err
 	}
-	patchStr := string(b)
+	return fmt.Errorf("could not undo changes to %s: %d conflict(s) with later edits; see %s",
+		filename, conflicts, mergeFile)
+
+}
 
-	// Apply patch.
+// Unpatch computes what ApplyPatch would make of a file with the given
+// content.  If there are conflicts, the result contains conflict markers.
+func (store *Store) Unpatch(filename, label, fileStr string) (string, int, error) {
+
+	// Read patch.
+	patchStr, err := store.ReadPatch(filename, label)
+	if err != nil {
+		return "", 0, err
+	}
 	dmp := diffmatchpatch.New()
-	patches, _ := dmp.PatchFromText(patchStr)
-	fileStr2, _ := dmp.PatchApply(patches, fileStr)
+	patches, err := dmp.PatchFromText(patchStr)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Older stores have no copy of the patched file, so all we
+	// can do is apply the patch hunk by hunk.
+	appliedStr, ok, err := store.readApplied(filename, label)
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		unpatched, results := dmp.PatchApply(patches, fileStr)
+		failed := failedHunks(results)
+		if len(failed) > 0 {
+			return "", 0, fmt.Errorf("could not undo changes to %s: hunk %s of %d does not apply; the file has changed since it was patched",
+				filename, strings.Join(failed, ", "), len(results))
+		}
+		return unpatched, 0, nil
+	}
 
-	// Write file.
-	return store.WriteFile(filename, []byte(fileStr2))
+	// The original is the patched file, unpatched.
+	origStr, results := dmp.PatchApply(patches, appliedStr)
+	failed := failedHunks(results)
+	if len(failed) > 0 {
+		return "", 0, fmt.Errorf("corrupt patch for %s: hunk %s of %d does not apply",
+			filename, strings.Join(failed, ", "), len(results))
+	}
+	if fileStr == appliedStr {
+		return origStr, 0, nil
+	}
+
+	// The file has changed since it was patched: keep those changes.
+	merged, conflicts := Merge3(fileStr, appliedStr, origStr)
+	return merged, conflicts, nil
 
 }
 
-// SavePatch computes and stores the patch between to strings.
+// failedHunks lists (counting from 1) the hunks which did not apply.
+func failedHunks(results []bool) []string {
+	failed := []string{}
+	for k, ok := range results {
+		if !ok {
+			failed = append(failed, strconv.Itoa(k+1))
+		}
+	}
+	return failed
+}
+
+// SavePatch computes and stores the patch between two strings.
 func (store *Store) SavePatch(filename, origStr, newStr, label string) error {
 
 	if store == nil {
@@ -55,17 +122,68 @@ func (store *Store) SavePatch(filename, origStr, newStr, label string) error {
 	patches := dmp.PatchMake(diffs)
 	strPatch := dmp.PatchToText(patches)
 
-	// Create the destination directory.
-	dest := store.createPath(filename, label)
-	dir := filepath.Dir(dest)
-	err := os.MkdirAll(dir, 0755)
+	// Store the patch, and the patched file for merging, and
+	// point the catalog at them.
+	hash, err := store.putBlob([]byte(strPatch))
 	if err != nil {
 		return err
 	}
+	applied, err := store.putBlob([]byte(newStr))
+	if err != nil {
+		return err
+	}
+	entries, k, err := store.entry(filename, label, "patch")
+	if err != nil {
+		return err
+	}
+	old := []string{entries[k].Patch, entries[k].Applied}
+	entries[k].Patch = hash
+	entries[k].Applied = applied
+	store.addTask(&entries[k])
+	err = store.saveEntries(entries)
+	if err != nil {
+		return err
+	}
+	if len(store.Dir) > 0 {
+		os.Remove(store.createPath(filename, label))
+	}
+
+	return store.pruneBlobs(old...)
 
-	// Write patch to file
-	err = ioutil.WriteFile(dest, []byte(strPatch), 0644)
+}
 
-	return err
+// ReadPatch reads the text of a stored patch.
+func (store *Store) ReadPatch(filename, label string) (string, error) {
 
+	entries, err := store.Entries()
+	if err != nil {
+		return "", err
+	}
+	k := findEntry(entries, filename, label, "patch")
+	if k >= 0 && len(entries[k].Patch) > 0 {
+		b, err := store.getBlob(entries[k].Patch)
+		return string(b), err
+	}
+
+	// Older versions of genesis kept patches directly at createPath.
+	if len(store.Dir) == 0 {
+		return "", &os.PathError{Op: "read", Path: filename, Err: os.ErrNotExist}
+	}
+	b, err := ioutil.ReadFile(store.createPath(filename, label))
+	return string(b), err
+
+}
+
+// readApplied reads the stored copy of the patched file, if there is one.
+func (store *Store) readApplied(filename, label string) (string, bool, error) {
+	entries, err := store.Entries()
+	if err != nil {
+		return "", false, err
+	}
+	k := findEntry(entries, filename, label, "patch")
+	if k < 0 || len(entries[k].Applied) == 0 {
+		return "", false, nil
+	}
+	b, err := store.getBlob(entries[k].Applied)
+	return string(b), true, err
 }
@@ -1,32 +1,70 @@
 // Package store provides support for keeping track of changes
 // to files.  It can keep a copy of a file, or a patch to reverse
-// changes to a file.
+// changes to a file.  Copies and patches are stored as gzipped blobs,
+// addressed by content hash, and indexed by a catalog.
 package store
 
 import (
 	"crypto/md5"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Store is for storing change information for a set of files.
 type Store struct {
-	Dir string
+	Dir     string  // directory of a DirBackend, for backups made by older versions
+	Backend Backend // where the catalog and blobs are kept
+	RunID   string  // identifies the current run, for file generations
+	Restore string  // which generation RestoreFile restores (see RestoreFile)
+	Task    TaskRef // the task currently running, for the catalog
 }
 
-// New generates a new Store object.
+// New generates a new Store object, kept in a directory.
 func New(dir string) (*Store, error) {
-	store := Store{Dir: dir}
+	store := NewWithBackend(DirBackend{Dir: dir})
+	store.Dir = dir
 	err := os.MkdirAll(store.Dir, 0755)
 	if err != nil {
-		return &store, err
+		return store, err
 	}
-	return &store, nil
+	return store, nil
 }
 
+// NewWithBackend generates a new Store object, kept in any backend.
+func NewWithBackend(backend Backend) *Store {
+	return &Store{
+		Backend: backend,
+		RunID:   time.Now().Format("20060102-150405.000"),
+	}
+}
+
+// NewMemory generates a new Store object kept in memory, for testing.
+func NewMemory() *Store {
+	return NewWithBackend(NewMemoryBackend())
+}
+
+// NewArchive generates a new Store object kept in a single zip file.
+func NewArchive(file string) (*Store, error) {
+	backend, err := OpenArchiveBackend(file)
+	return NewWithBackend(backend), err
+}
+
+// Close writes out any changes which the backend has not yet saved
+// (for backends which batch their writes, such as ArchiveBackend).
+func (store *Store) Close() error {
+	if closer, ok := store.Backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// createPath is where older versions of genesis kept backups.  Only
+// directory stores have them.
 func (store *Store) createPath(filename, label string) string {
 	if len(label) > 0 {
 		label = fmt.Sprintf("%x", md5.Sum([]byte(label)))
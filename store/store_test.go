@@ -1,10 +1,14 @@
 package store_test
 
 import (
+	"archive/zip"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/wx13/genesis/store"
 )
@@ -77,3 +81,318 @@ func TestStore(t *testing.T) {
 	}
 
 }
+
+func TestGenerations(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir for testing purposes")
+	}
+	defer os.RemoveAll(dir)
+	s, _ := store.New(filepath.Join(dir, "store"))
+	filename := filepath.Join(dir, "myfile.txt")
+
+	// Three runs, each changing the file.  The file didn't exist at first.
+	for k, text := range []string{"one", "two", "three"} {
+		s.RunID = fmt.Sprintf("run%d", k)
+		s.SaveFile(filename, "")
+		s.SaveFile(filename, "")
+		ioutil.WriteFile(filename, []byte(text), 0644)
+	}
+	gens, _ := s.Generations(filename, "")
+	if len(gens) != 3 || !gens[0].Missing || gens[2].RunID != "run2" {
+		t.Fatalf("Expected 3 generations, one per run: %+v", gens)
+	}
+
+	// Step back one change at a time.
+	s.Restore = "previous"
+	s.RestoreFile(filename, "")
+	data, _ := ioutil.ReadFile(filename)
+	if string(data) != "two" {
+		t.Error("Previous generation was not restored:", string(data))
+	}
+	s.RestoreFile(filename, "")
+	data, _ = ioutil.ReadFile(filename)
+	if string(data) != "one" {
+		t.Error("Previous generation was not restored:", string(data))
+	}
+
+	// Then all the way back to the original.
+	s.Restore = "original"
+	s.RestoreFile(filename, "")
+	if _, err := os.Stat(filename); err == nil {
+		t.Error("Original file did not exist, and should have been removed.")
+	}
+	gens, _ = s.Generations(filename, "")
+	if len(gens) != 1 {
+		t.Error("Original generation should be kept:", gens)
+	}
+
+}
+
+func TestMetadata(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir for testing purposes")
+	}
+	defer os.RemoveAll(dir)
+	s, _ := store.New(filepath.Join(dir, "store"))
+
+	// No backup: leave the file alone.
+	filename := filepath.Join(dir, "shadow")
+	ioutil.WriteFile(filename, []byte("secret"), 0640)
+	if s.RestoreFile(filename, "") != store.ErrNoBackup {
+		t.Error("Restoring a file without a backup should return ErrNoBackup.")
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Error("File without a backup should not be removed.")
+	}
+
+	// Mode and mtime are restored.
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	os.Chtimes(filename, mtime, mtime)
+	s.SaveFile(filename, "")
+	ioutil.WriteFile(filename, []byte("changed"), 0644)
+	os.Chmod(filename, 0644)
+	s.RestoreFile(filename, "")
+	info, _ := os.Stat(filename)
+	if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+		t.Error("Mode and mtime were not restored:", info.Mode(), info.ModTime())
+	}
+
+	// Symlinks are restored as symlinks.
+	link := filepath.Join(dir, "link")
+	os.Symlink("shadow", link)
+	s.SaveFile(link, "")
+	os.Remove(link)
+	ioutil.WriteFile(link, []byte("not a link"), 0644)
+	s.RestoreFile(link, "")
+	target, err := os.Readlink(link)
+	if err != nil || target != "shadow" {
+		t.Error("Symlink was not restored:", target, err)
+	}
+
+}
+
+func TestCatalog(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir for testing purposes")
+	}
+	defer os.RemoveAll(dir)
+	s, _ := store.New(filepath.Join(dir, "store"))
+	filename := filepath.Join(dir, "myfile.txt")
+	ioutil.WriteFile(filename, []byte("a\nb\n"), 0644)
+
+	s.Task = store.TaskRef{Tag: "abc123", Desc: "CopyFile"}
+	s.SaveFile(filename, "")
+	s.Task = store.TaskRef{Tag: "def456", Desc: "LineInFile"}
+	s.SavePatch(filename, "a\nb\n", "a\nc\n", "lif")
+
+	entries, _ := s.Entries()
+	if len(entries) != 2 || entries[0].Path != filename || entries[0].Kind != "file" ||
+		entries[1].Kind != "patch" || entries[1].Tasks[0].Tag != "def456" {
+		t.Fatalf("Unexpected store entries: %+v", entries)
+	}
+
+	err = s.RemoveEntry(entries[0])
+	if err != nil {
+		t.Error("Could not remove entry:", err)
+	}
+	entries, _ = s.Entries()
+	gens, _ := s.Generations(filename, "")
+	if len(entries) != 1 || len(gens) != 0 {
+		t.Error("Entry was not removed:", entries, gens)
+	}
+
+	if store.Diff("a\nb\n", "a\nc\n") != " a\n-b\n+c" {
+		t.Errorf("Unexpected diff: %q", store.Diff("a\nb\n", "a\nc\n"))
+	}
+
+}
+
+func TestBlobs(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir for testing purposes")
+	}
+	defer os.RemoveAll(dir)
+	storeDir := filepath.Join(dir, "store")
+	s, _ := store.New(storeDir)
+
+	// Identical files are stored once.
+	for _, name := range []string{"a", "b"} {
+		filename := filepath.Join(dir, name)
+		ioutil.WriteFile(filename, []byte("firmware"), 0644)
+		s.SaveFile(filename, "")
+		s.SaveFile(filename, "label")
+	}
+	blobs, _ := filepath.Glob(filepath.Join(storeDir, "blobs", "*", "*.gz"))
+	if len(blobs) != 1 {
+		t.Error("Identical files should share one blob:", blobs)
+	}
+
+	// Backups from older versions of genesis are still restored.
+	filename := filepath.Join(dir, "old")
+	legacy := filepath.Join(storeDir, filename)
+	os.MkdirAll(filepath.Dir(legacy), 0755)
+	ioutil.WriteFile(legacy, []byte("old backup"), 0644)
+	ioutil.WriteFile(filename, []byte("new"), 0644)
+	err = s.RestoreFile(filename, "")
+	data, _ := ioutil.ReadFile(filename)
+	if err != nil || string(data) != "old backup" {
+		t.Error("Legacy backup was not restored:", err, string(data))
+	}
+	if _, err := os.Stat(legacy); err == nil {
+		t.Error("Legacy backup should have been moved into the blob store.")
+	}
+
+}
+
+func TestBackends(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir for testing purposes")
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "store.zip")
+	s1, err := store.NewArchive(archive)
+	if err != nil {
+		t.Error("Could not create archive store:", err)
+	}
+	stores := map[string]*store.Store{
+		"memory":  store.NewMemory(),
+		"archive": s1,
+	}
+
+	for name, s := range stores {
+
+		filename := filepath.Join(dir, name+".txt")
+		ioutil.WriteFile(filename, []byte("original\n"), 0644)
+		err = s.SaveFile(filename, "")
+		if err != nil {
+			t.Error("Could not save file to", name, "store:", err)
+		}
+		err = s.SavePatch(filename, "original\n", "changed\n", "edit")
+		if err != nil {
+			t.Error("Could not save patch to", name, "store:", err)
+		}
+		ioutil.WriteFile(filename, []byte("changed\n"), 0644)
+
+		err = s.ApplyPatch(filename, "edit")
+		data, _ := ioutil.ReadFile(filename)
+		if err != nil || string(data) != "original\n" {
+			t.Error("Patch from", name, "store was not applied:", err, string(data))
+		}
+		os.Remove(filename)
+		err = s.RestoreFile(filename, "")
+		data, _ = ioutil.ReadFile(filename)
+		if err != nil || string(data) != "original\n" {
+			t.Error("File from", name, "store was not restored:", err, string(data))
+		}
+
+	}
+
+	// Changes are written out when the store is closed, with blobs
+	// stored as they are (they are already compressed).
+	if _, err := os.Stat(archive); err == nil {
+		t.Error("Archive should not be written before the store is closed.")
+	}
+	err = s1.Close()
+	if err != nil {
+		t.Error("Could not close archive store:", err)
+	}
+	zipRdr, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal("Could not open archive:", err)
+	}
+	for _, f := range zipRdr.File {
+		if strings.HasSuffix(f.Name, ".gz") && f.Method != zip.Store {
+			t.Error("Blob should be stored without compression:", f.Name)
+		}
+	}
+	zipRdr.Close()
+
+	// The archive survives reopening, and nothing leaks into the
+	// directory it lives in.
+	s2, err := store.NewArchive(archive)
+	if err != nil {
+		t.Error("Could not reopen archive store:", err)
+	}
+	entries, _ := s2.Entries()
+	if len(entries) != 2 {
+		t.Error("Reopened archive should have 2 entries, but has", len(entries))
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Error("Archive store should be a single file.", len(files))
+	}
+
+	// If the archive cannot be written, unsaved changes are dropped.
+	backend, _ := store.OpenArchiveBackend(filepath.Join(dir, "memory.txt", "store.zip"))
+	backend.Write("item", []byte("data"))
+	if backend.Flush() == nil || backend.Exists("item") {
+		t.Error("A failed flush should drop unsaved changes.")
+	}
+
+}
+
+func TestMerge3(t *testing.T) {
+
+	base := "a\nb\nc\nd\ne\n"
+	current := "a\nb\nc\nd\nE\n"
+	other := "A\nb\nc\nd\ne\n"
+	merged, conflicts := store.Merge3(current, base, other)
+	if conflicts != 0 || merged != "A\nb\nc\nd\nE\n" {
+		t.Error("Bad clean merge:", conflicts, merged)
+	}
+
+	current = "a\nB\nc\nd\ne\n"
+	other = "a\nb2\nc\nd\ne\n"
+	merged, conflicts = store.Merge3(current, base, other)
+	expected := "a\n<<<<<<< current\nB\n||||||| genesis\nb\n=======\nb2\n>>>>>>> original\nc\nd\ne\n"
+	if conflicts != 1 || merged != expected {
+		t.Error("Bad conflicting merge:", conflicts, merged)
+	}
+
+}
+
+func TestPatchMerge(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genesis_test")
+	if err != nil {
+		t.Fatal("Could not create temp dir for testing purposes")
+	}
+	defer os.RemoveAll(dir)
+	s := store.NewMemory()
+	filename := filepath.Join(dir, "sshd_config")
+	orig := "Port 22\nPermitRootLogin yes\nX11Forwarding yes\n"
+	patched := "Port 22\nPermitRootLogin no\nX11Forwarding yes\n"
+	s.SavePatch(filename, orig, patched, "")
+
+	// Later edits to other lines are kept.
+	ioutil.WriteFile(filename, []byte("Port 2222\nPermitRootLogin no\nX11Forwarding yes\n"), 0600)
+	err = s.ApplyPatch(filename, "")
+	data, _ := ioutil.ReadFile(filename)
+	if err != nil || string(data) != "Port 2222\nPermitRootLogin yes\nX11Forwarding yes\n" {
+		t.Error("Later edits should survive removal:", err, string(data))
+	}
+
+	// Conflicting edits leave the file alone.
+	edited := "Port 22\nPermitRootLogin prohibit-password\nX11Forwarding yes\n"
+	ioutil.WriteFile(filename, []byte(edited), 0600)
+	err = s.ApplyPatch(filename, "")
+	data, _ = ioutil.ReadFile(filename)
+	if err == nil || string(data) != edited {
+		t.Error("Conflicting edits should not be merged:", err, string(data))
+	}
+	if _, err := os.Stat(filename + ".genesis-merge"); err != nil {
+		t.Error("Conflicts should be written beside the file.", err)
+	}
+
+}